@@ -0,0 +1,70 @@
+package goenv
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var errShortBinary = errors.New("truncated binary env data")
+
+// MarshalBinary encodes m in a compact length-prefixed format: for each
+// pair, a 4-byte big-endian key length, the key bytes, a 4-byte
+// big-endian value length and the value bytes. Pairs are written in key
+// order so the output is deterministic.
+func MarshalBinary(m map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	size := 0
+	for k, v := range m {
+		if uint64(len(k)) > math.MaxUint32 || uint64(len(v)) > math.MaxUint32 {
+			return nil, errors.New("binary env entry too large")
+		}
+		keys = append(keys, k)
+		size += 8 + len(k) + len(v)
+	}
+	sort.Strings(keys)
+
+	buf := make([]byte, 0, size)
+	for _, k := range keys {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(k)))
+		buf = append(buf, k...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(m[k])))
+		buf = append(buf, m[k]...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary in a single
+// pass. data is copied into one string up front and keys and values are
+// sliced from it, so decoding does not allocate per key.
+func UnmarshalBinary(data []byte) (map[string]string, error) {
+	s := string(data)
+	envMap := make(map[string]string)
+	for len(s) > 0 {
+		k, rest, err := readBinaryField(s)
+		if err != nil {
+			return nil, err
+		}
+		v, rest, err := readBinaryField(rest)
+		if err != nil {
+			return nil, err
+		}
+		envMap[k] = v
+		s = rest
+	}
+	return envMap, nil
+}
+
+// readBinaryField reads one length-prefixed field from s.
+func readBinaryField(s string) (field, rest string, err error) {
+	if len(s) < 4 {
+		return "", "", errShortBinary
+	}
+	n := uint64(s[0])<<24 | uint64(s[1])<<16 | uint64(s[2])<<8 | uint64(s[3])
+	s = s[4:]
+	if uint64(len(s)) < n {
+		return "", "", errShortBinary
+	}
+	return s[:n], s[n:], nil
+}
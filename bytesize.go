@@ -0,0 +1,115 @@
+package goenv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes that reads and prints in human-readable
+// form, such as 512MB or 1.5 GiB.
+type ByteSize int64
+
+// Binary and decimal byte size units.
+const (
+	B   ByteSize = 1
+	KiB ByteSize = 1 << (10 * iota)
+	MiB
+	GiB
+	TiB
+)
+
+const (
+	KB ByteSize = 1000
+	MB          = 1000 * KB
+	GB          = 1000 * MB
+	TB          = 1000 * GB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    B,
+	"b":   B,
+	"kb":  KB,
+	"kib": KiB,
+	"mb":  MB,
+	"mib": MiB,
+	"gb":  GB,
+	"gib": GiB,
+	"tb":  TB,
+	"tib": TiB,
+}
+
+// String formats the size with the largest binary unit that keeps the
+// number at or above 1, with at most two decimals: 1.5 GiB.
+func (s ByteSize) String() string {
+	units := []struct {
+		size ByteSize
+		name string
+	}{{TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}}
+	abs := s
+	if abs < 0 {
+		abs = -abs
+	}
+	for _, u := range units {
+		if abs >= u.size {
+			v := math.Round(float64(s)/float64(u.size)*100) / 100
+			return strconv.FormatFloat(v, 'f', -1, 64) + " " + u.name
+		}
+	}
+	return strconv.FormatInt(int64(s), 10) + " B"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	v, err := parseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// GetByteSize returns the size represented by the string: a number,
+// optionally fractional, followed by an optional unit among B, KB,
+// KiB, MB, MiB, GB, GiB, TB and TiB, matched case-insensitively. KB
+// and friends are powers of 1000, KiB and friends powers of 1024.
+func GetByteSize(key string, defaultValue ByteSize) (ByteSize, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	size, err := parseByteSize(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return size, nil
+}
+
+func parseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+')
+	})
+	if end == -1 {
+		end = len(s)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[end:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q: unknown unit", s)
+	}
+	n, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	size := n * float64(unit)
+	if size > math.MaxInt64 || size < math.MinInt64 {
+		return 0, fmt.Errorf("byte size %q out of range", s)
+	}
+	return ByteSize(size), nil
+}
@@ -0,0 +1,79 @@
+package goenv
+
+import "sync"
+
+// CacheEnv turns the read cache on or off. While enabled, Get and the
+// typed getters built on it read from a snapshot of the environment
+// taken when caching was enabled instead of calling os.LookupEnv.
+// Cached reads do not see later os.Setenv or Load calls until
+// Invalidate is called. Disabling the cache discards the snapshot.
+func CacheEnv(enabled bool) {
+	updateLookup(func(state *lookupState) {
+		state.cache = nil
+		if enabled {
+			state.cache = EnvMap()
+		}
+	})
+}
+
+// Invalidate refreshes the cache snapshot from the current environment,
+// for example after a reload. It does nothing while the cache is
+// disabled.
+func Invalidate() {
+	updateLookup(func(state *lookupState) {
+		if state.cache != nil {
+			state.cache = EnvMap()
+		}
+	})
+}
+
+// Cache is a read-through cache of environment lookups, for hot paths
+// that read the same keys very often. Each key is looked up on first
+// use and served from memory afterwards, so later changes to the
+// environment are only seen after Invalidate or InvalidateAll. A Cache
+// is safe for concurrent use.
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value string
+	found bool
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{entries: map[string]cacheEntry{}}
+}
+
+// Get is like the package-level Get but caches the lookup of key.
+func (c *Cache) Get(key, defaultValue string) string {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		e.value, e.found = lookupEnv(key)
+		c.mu.Lock()
+		c.entries[key] = e
+		c.mu.Unlock()
+	}
+	if !e.found {
+		return defaultValue
+	}
+	return TrimFunc(e.value)
+}
+
+// Invalidate drops the cached lookup of key.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// InvalidateAll drops every cached lookup.
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	c.entries = map[string]cacheEntry{}
+	c.mu.Unlock()
+}
@@ -0,0 +1,70 @@
+package goenv
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// ChangeFunc is called with the previous and the new value
+// of a variable after it has been changed.
+type ChangeFunc func(key, oldValue, newValue string)
+
+var (
+	changeMu        sync.Mutex
+	changeCallbacks = map[string][]*ChangeFunc{}
+
+	// rotateMu makes reading the old value and setting the new one
+	// a single step, so concurrent rotations report a consistent
+	// chain of values.
+	rotateMu sync.Mutex
+)
+
+// OnChange registers fn to be called whenever key is changed by Rotate.
+// The returned function unregisters it.
+func OnChange(key string, fn ChangeFunc) (unregister func()) {
+	entry := &fn
+	changeMu.Lock()
+	changeCallbacks[key] = append(changeCallbacks[key], entry)
+	changeMu.Unlock()
+
+	return func() {
+		changeMu.Lock()
+		defer changeMu.Unlock()
+		callbacks := changeCallbacks[key]
+		for i, e := range callbacks {
+			if e == entry {
+				changeCallbacks[key] = append(callbacks[:i:i], callbacks[i+1:]...)
+				break
+			}
+		}
+		if len(changeCallbacks[key]) == 0 {
+			delete(changeCallbacks, key)
+		}
+	}
+}
+
+// Rotate sets key to newValue, calls the OnChange callbacks registered
+// for key and writes an audit entry to the standard logger. The value
+// itself never appears in the log. Concurrent calls are serialized, so
+// each callback sees the value its rotation actually replaced. The
+// callbacks run without any lock held, so they may call Rotate or
+// OnChange themselves.
+func Rotate(key, newValue string) error {
+	rotateMu.Lock()
+	oldValue := os.Getenv(key)
+	if err := os.Setenv(key, newValue); err != nil {
+		rotateMu.Unlock()
+		return err
+	}
+	changeMu.Lock()
+	callbacks := append([]*ChangeFunc(nil), changeCallbacks[key]...)
+	changeMu.Unlock()
+	rotateMu.Unlock()
+
+	for _, fn := range callbacks {
+		(*fn)(key, oldValue, newValue)
+	}
+	log.Printf("goenv: rotated %s (value redacted)", key)
+	return nil
+}
@@ -0,0 +1,39 @@
+package goenv
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// HexColor returns the color represented by a #RRGGBB or #RGB hex
+// string, such as "#3498db" or "#fff". The leading '#' is optional and
+// the returned color is fully opaque. The default value is returned
+// when the key is not set.
+func HexColor(key string, defaultValue color.RGBA) (color.RGBA, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	c, err := parseHexColor(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return c, nil
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q: want 3 or 6 hex digits", s)
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xff}, nil
+}
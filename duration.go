@@ -0,0 +1,102 @@
+package goenv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DurationISO returns the duration represented by an ISO 8601 duration
+// string such as "PT1H30M", "P1DT12H" or "PT0.5S". Weeks (W) and days
+// (D) are taken as exactly 7 and 24 hours. Years and months have no
+// fixed length, so values using them, such as "P1Y" or "P2M", are
+// rejected rather than approximated; note that M means minutes after
+// the T. A leading minus sign gives a negative duration. The default
+// value is returned when the key is not set.
+func DurationISO(key string, defaultValue time.Duration) (time.Duration, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := parseISODuration(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+func parseISODuration(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid ISO 8601 duration %q", s)
+	rest, negative := strings.CutPrefix(s, "-")
+	rest, ok := strings.CutPrefix(rest, "P")
+	if !ok || rest == "" || rest == "T" {
+		return 0, invalid
+	}
+
+	var total float64
+	// last is the position in the designator order of the previous
+	// component, so designators appear at most once and in order
+	inTime, last := false, -1
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime {
+				return 0, invalid
+			}
+			inTime, last = true, -1
+			rest = rest[1:]
+			continue
+		}
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return !(r >= '0' && r <= '9' || r == '.' || r == ',')
+		})
+		if end <= 0 {
+			return 0, invalid
+		}
+		n, err := strconv.ParseFloat(strings.Replace(rest[:end], ",", ".", 1), 64)
+		if err != nil {
+			return 0, invalid
+		}
+		designator := rest[end]
+		rest = rest[end+1:]
+
+		var unit time.Duration
+		order := "YMWD"
+		if inTime {
+			order = "HMS"
+		}
+		switch {
+		case !inTime && (designator == 'Y' || designator == 'M'):
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q: years and months have no fixed length", s)
+		case !inTime && designator == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && designator == 'D':
+			unit = 24 * time.Hour
+		case inTime && designator == 'H':
+			unit = time.Hour
+		case inTime && designator == 'M':
+			unit = time.Minute
+		case inTime && designator == 'S':
+			unit = time.Second
+		default:
+			return 0, invalid
+		}
+		pos := strings.IndexByte(order, designator)
+		if pos <= last {
+			return 0, invalid
+		}
+		last = pos
+		total += n * float64(unit)
+	}
+	if inTime && last == -1 {
+		return 0, invalid
+	}
+	if total > math.MaxInt64 {
+		return 0, fmt.Errorf("ISO 8601 duration %q out of range", s)
+	}
+	if negative {
+		total = -total
+	}
+	return time.Duration(total), nil
+}
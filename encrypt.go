@@ -0,0 +1,70 @@
+package goenv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrDecrypt is returned by LoadEncrypted when a file cannot be
+// authenticated, either because the key is wrong or the file was
+// tampered with.
+var ErrDecrypt = errors.New("decryption failed: wrong key or corrupted file")
+
+// LoadEncrypted decrypts an AES-GCM encrypted file, stored as the
+// nonce followed by the ciphertext, and loads the plaintext like Load.
+// key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or
+// AES-256.
+func LoadEncrypted(filename string, key []byte) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return fmt.Errorf("%s: %w", filename, ErrDecrypt)
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, ErrDecrypt)
+	}
+	envMap, err := Parse(bytes.NewReader(plaintext), defaultParseOptions)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	applyEnvMap(envMap, filename, LoadOptions{})
+	return nil
+}
+
+// WriteEncrypted writes envMap in dotenv format to filename, encrypted
+// with AES-GCM under key in the format read by LoadEncrypted. Every
+// value is quoted, so values read back exactly as written. The file
+// is created with mode 0600.
+func WriteEncrypted(filename string, envMap map[string]string, key []byte) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(marshalMapFormat(envMap, quoteValue)+"\n"), nil)
+	return os.WriteFile(filename, data, 0o600)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
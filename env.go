@@ -1,16 +1,35 @@
 package goenv
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"golang.org/x/exp/constraints"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
 )
 
+// ErrAlreadySet is returned when a destination variable
+// is already set and overwriting was not requested.
+var ErrAlreadySet = errors.New("variable already set")
+
 // IsSet returns if the given env key is set.
 // remember ENV must be a non-empty. All empty
 // values are considered unset.
@@ -18,30 +37,489 @@ func IsSet(key string) bool {
 	return Get(key, "") != ""
 }
 
+// WaitForKey blocks until key is set, checking every pollInterval.
+// It returns ctx.Err() if the context is done first, and an error if
+// pollInterval is not positive.
+func WaitForKey(ctx context.Context, key string, pollInterval time.Duration) error {
+	if pollInterval <= 0 {
+		return fmt.Errorf("%s: non-positive poll interval %v", key, pollInterval)
+	}
+	if IsSet(key) {
+		return nil
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if IsSet(key) {
+				return nil
+			}
+		}
+	}
+}
+
 // Get a value from the ENV. If it doesn't exist the
 // default value will be returned.
 func Get(key string, defaultValue string) string {
+	if v, ok := lookupEnv(key); ok {
+		return TrimFunc(v)
+	}
+	return defaultValue
+}
+
+// TrimFunc is applied by Get, and so by every getter built on it, to
+// the values it reads. It defaults to trimming leading and trailing
+// spaces. Setting it to func(s string) string { return s } disables
+// trimming. TrimFunc is process-global: changing it affects all
+// getters in every package using goenv, so set it once during startup.
+// Set it to TrimUnicodeSpace to also trim Unicode whitespace.
+var TrimFunc = fastTrim
+
+// GetNonEmpty is like Get but also returns the default value when the
+// key is set to an empty or whitespace-only value. Get returns the
+// empty string in that case, because the key is set.
+func GetNonEmpty(key string, defaultValue string) string {
+	if v := Get(key, ""); v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// GetMulti looks up every key of defaults and returns a map with the
+// value from the environment where set, and the default otherwise.
+func GetMulti(defaults map[string]string) map[string]string {
+	values := make(map[string]string, len(defaults))
+	for key, defaultValue := range defaults {
+		values[key] = Get(key, defaultValue)
+	}
+	return values
+}
+
+// GetMany returns Get(key, defaultValue) for each of keys, in order.
+func GetMany(defaultValue string, keys ...string) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = Get(key, defaultValue)
+	}
+	return values
+}
+
+// GetScoped looks up scope + "_" + key first and falls back to key,
+// then to the default value, so GetScoped("TENANT_42", "DB", "")
+// prefers TENANT_42_DB over DB. An empty scope looks up key only.
+func GetScoped(scope, key, defaultValue string) string {
+	if scope != "" {
+		if v, ok := lookupEnv(scope + "_" + key); ok {
+			return TrimFunc(v)
+		}
+	}
+	return Get(key, defaultValue)
+}
+
+// GetOrSet returns the value of key if it is set. Otherwise it sets
+// key to value and returns value. Like the getters, it honors the
+// global prefix and key normalizer, and the value returned is trimmed
+// like Get does. If key cannot be set, as for an empty key, value is
+// still returned but the environment is left unchanged.
+func GetOrSet(key, value string) string {
+	key = lookupKey(key)
 	if v, ok := os.LookupEnv(key); ok {
-		return fastTrim(v)
+		return TrimFunc(v)
+	}
+	_ = os.Setenv(key, value)
+	return TrimFunc(value)
+}
+
+// GetRaw is like Get but returns the value exactly as stored
+// in the environment, including leading and trailing spaces.
+func GetRaw(key string, defaultValue string) string {
+	if v, ok := lookupEnv(key); ok {
+		return v
 	}
 	return defaultValue
 }
 
+// lookupState holds what the getters apply to every lookup: the
+// global prefix, the key normalizer and the cache snapshot. It is
+// never modified once published; the setters store a new one.
+type lookupState struct {
+	prefix     string
+	normalizer func(string) string
+	cache      map[string]string
+}
+
+var (
+	// lookupMu serializes updates of lookupConfig.
+	lookupMu sync.Mutex
+
+	// lookupConfig is nil while no prefix, normalizer or cache is set,
+	// so the default lookup costs a single atomic load.
+	lookupConfig atomic.Pointer[lookupState]
+)
+
+// updateLookup applies fn to a copy of the current lookup state and
+// publishes the result.
+func updateLookup(fn func(state *lookupState)) {
+	lookupMu.Lock()
+	defer lookupMu.Unlock()
+	var next lookupState
+	if cur := lookupConfig.Load(); cur != nil {
+		next = *cur
+	}
+	fn(&next)
+	if next.prefix == "" && next.normalizer == nil && next.cache == nil {
+		lookupConfig.Store(nil)
+		return
+	}
+	lookupConfig.Store(&next)
+}
+
+// SetGlobalPrefix makes the getters prepend prefix to every key they
+// look up, so that with SetGlobalPrefix("BILLING_") Get("PORT") reads
+// BILLING_PORT. The prefix is added before the key normalizer runs.
+// SetGlobalPrefix("") restores the default behavior.
+func SetGlobalPrefix(prefix string) {
+	updateLookup(func(state *lookupState) { state.prefix = prefix })
+}
+
+// SetKeyNormalizer registers fn to rewrite every key before the
+// getters look it up, e.g. UpperCaseNormalizer so that Get("port")
+// finds PORT. It does not change what is stored in the environment.
+// Passing nil removes the normalizer.
+func SetKeyNormalizer(fn func(string) string) {
+	updateLookup(func(state *lookupState) { state.normalizer = fn })
+}
+
+// UpperCaseNormalizer is a key normalizer that upper-cases keys.
+func UpperCaseNormalizer(key string) string {
+	return strings.ToUpper(key)
+}
+
+// LowerCaseNormalizer is a key normalizer that lower-cases keys.
+func LowerCaseNormalizer(key string) string {
+	return strings.ToLower(key)
+}
+
+// lookupKey returns the environment key the getters use for key.
+func lookupKey(key string) string {
+	return lookupConfig.Load().key(key)
+}
+
+// key applies the prefix and the normalizer of s to key.
+func (s *lookupState) key(key string) string {
+	if s == nil {
+		return key
+	}
+	key = s.prefix + key
+	if s.normalizer != nil {
+		key = s.normalizer(key)
+	}
+	return key
+}
+
+func lookupEnv(key string) (string, bool) {
+	state := lookupConfig.Load()
+	if state == nil {
+		return os.LookupEnv(key)
+	}
+	key = state.key(key)
+	if state.cache != nil {
+		v, ok := state.cache[key]
+		return v, ok
+	}
+	return os.LookupEnv(key)
+}
+
+// Copy sets dst to the value of src. Nothing happens when src is not
+// set. If dst is already set ErrAlreadySet is returned, unless
+// overwrite is passed as true.
+func Copy(src, dst string, overwrite ...bool) error {
+	v, ok := os.LookupEnv(src)
+	if !ok {
+		return nil
+	}
+	if _, exists := os.LookupEnv(dst); exists && !(len(overwrite) > 0 && overwrite[0]) {
+		return fmt.Errorf("%s: %w", dst, ErrAlreadySet)
+	}
+	return os.Setenv(dst, v)
+}
+
+// Migrate copies the value of a renamed variable from oldKey to newKey
+// and, when removeOld is true, unsets oldKey. If newKey is already set
+// it takes precedence and nothing is changed. Migrate reports whether
+// a value was migrated.
+func Migrate(oldKey, newKey string, removeOld bool) bool {
+	if _, ok := os.LookupEnv(oldKey); !ok {
+		return false
+	}
+	if err := Copy(oldKey, newKey); err != nil {
+		return false
+	}
+	if removeOld {
+		_ = os.Unsetenv(oldKey)
+	}
+	return true
+}
+
 // Bool returns the boolean value represented by the string.
 func Bool(key string, defaultValue bool) bool {
-	val := Get(key, "")
-	if val == "true" ||
+	if isTruthy(Get(key, "")) {
+		return true
+	}
+	return defaultValue
+}
+
+// BoolPtr returns a tri-state boolean: nil when the key is not set or
+// empty, and otherwise a pointer to true for the values Bool accepts as
+// true and to false for anything else. It lets config merging tell an
+// explicit false from an unset key.
+func BoolPtr(key string) *bool {
+	v := Get(key, "")
+	if v == "" {
+		return nil
+	}
+	b := isTruthy(v)
+	return &b
+}
+
+func isTruthy(val string) bool {
+	return val == "true" ||
 		val == "1" ||
 		val == "t" ||
 		val == "T" ||
 		val == "TRUE" ||
-		val == "True" {
-		return true
+		val == "True"
+}
+
+// BoolStrict returns the boolean value represented by the string.
+// Unlike Bool, a value that is set but is not a recognized boolean
+// string, such as the typo "ture", results in an error instead of the
+// default value. The accepted tokens are those of strconv.ParseBool:
+// 1, t, T, TRUE, true and True for true, and 0, f, F, FALSE, false and
+// False for false. An unset or empty value yields the default.
+func BoolStrict(key string, defaultValue bool) (bool, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
+// BoolOption configures BoolWith.
+type BoolOption func(*boolOptions)
+
+type boolOptions struct {
+	truthy, falsy []string
+}
+
+// WithTruthy adds values that BoolWith accepts as true, such as "yes"
+// or "on".
+func WithTruthy(values ...string) BoolOption {
+	return func(o *boolOptions) {
+		o.truthy = append(o.truthy, values...)
+	}
+}
+
+// WithFalsy adds values that BoolWith accepts as false, such as "no"
+// or "off".
+func WithFalsy(values ...string) BoolOption {
+	return func(o *boolOptions) {
+		o.falsy = append(o.falsy, values...)
+	}
+}
+
+// BoolWith is like BoolStrict but also accepts the values configured
+// with WithTruthy and WithFalsy, compared case-insensitively. A value
+// that is set but matches none of them results in an error.
+func BoolWith(key string, defaultValue bool, opts ...BoolOption) (bool, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	var o boolOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, t := range o.truthy {
+		if strings.EqualFold(v, t) {
+			return true, nil
+		}
+	}
+	for _, f := range o.falsy {
+		if strings.EqualFold(v, f) {
+			return false, nil
+		}
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: unrecognized boolean %q", key, v)
+	}
+	return b, nil
+}
+
+// Bools returns the comma separated list of booleans represented by
+// the string. Each element is parsed like BoolStrict; an unrecognized
+// element results in an error naming its index.
+func Bools(key string, defaultValue []bool) ([]bool, error) {
+	return Slice(key, ",", defaultValue, strconv.ParseBool)
+}
+
+// Slice splits the value on sep and converts every element with parse.
+// Elements are trimmed and empty elements are skipped. A parse failure
+// results in an error naming the index of the offending element. The
+// default value is returned when the key is not set.
+func Slice[T any](key, sep string, defaultValue []T, parse func(string) (T, error)) ([]T, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	parts := strings.Split(v, sep)
+	values := make([]T, 0, len(parts))
+	for i, part := range parts {
+		part = fastTrim(part)
+		if part == "" {
+			continue
+		}
+		value, err := parse(part)
+		if err != nil {
+			return defaultValue, fmt.Errorf("%s[%d]: %w", key, i, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// RuneList returns the comma separated list of characters represented
+// by the string, such as "A,B,ä". An element is either a single
+// character or a code point in U+XXXX notation, which is how a comma
+// or a space is written. Elements are trimmed and empty elements are
+// skipped. Like IntList, the valid elements are returned together with
+// an error listing every invalid element with its index.
+func RuneList(key string, defaultValue []rune) ([]rune, error) {
+	return parseList(key, defaultValue, parseRune)
+}
+
+func parseRune(s string) (rune, error) {
+	if hex, ok := strings.CutPrefix(s, "U+"); ok {
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			return 0, fmt.Errorf("invalid code point %q", s)
+		}
+		return rune(n), nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || size != len(s) {
+		return 0, fmt.Errorf("invalid character %q: want a single character or U+XXXX", s)
+	}
+	return r, nil
+}
+
+// IntList returns the comma separated list of integers represented by
+// the string, such as "1,2,3". Elements are trimmed and empty elements
+// are skipped. Unlike Slice, parsing continues past invalid elements:
+// the valid ones are returned together with an error listing every
+// invalid element with its index.
+func IntList(key string, defaultValue []int) ([]int, error) {
+	return parseList(key, defaultValue, strconv.Atoi)
+}
+
+// Int64List is like IntList for int64 values.
+func Int64List(key string, defaultValue []int64) ([]int64, error) {
+	return parseList(key, defaultValue, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+}
+
+// UintList is like IntList for uint values.
+func UintList(key string, defaultValue []uint) ([]uint, error) {
+	return parseList(key, defaultValue, func(s string) (uint, error) {
+		n, err := strconv.ParseUint(s, 10, strconv.IntSize)
+		return uint(n), err
+	})
+}
+
+func parseList[T any](key string, defaultValue []T, parse func(string) (T, error)) ([]T, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	parts := strings.Split(v, ",")
+	values := make([]T, 0, len(parts))
+	var errs []error
+	for i, part := range parts {
+		part = fastTrim(part)
+		if part == "" {
+			continue
+		}
+		value, err := parse(part)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d]: %w", key, i, err))
+			continue
+		}
+		values = append(values, value)
+	}
+	return values, errors.Join(errs...)
+}
+
+// ParsedMap splits the value into pairs on pairSep and each pair into a
+// key and a value on the first kvSep, converting them with parseK and
+// parseV. Pairs are trimmed and empty pairs are skipped. Errors name
+// the index of the offending pair. The default value is returned when
+// the key is not set.
+func ParsedMap[K comparable, V any](key, pairSep, kvSep string, defaultValue map[K]V, parseK func(string) (K, error), parseV func(string) (V, error)) (map[K]V, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	pairs := strings.Split(v, pairSep)
+	m := make(map[K]V, len(pairs))
+	for i, pair := range pairs {
+		pair = fastTrim(pair)
+		if pair == "" {
+			continue
+		}
+		rawK, rawV, ok := strings.Cut(pair, kvSep)
+		if !ok {
+			return defaultValue, fmt.Errorf("%s[%d]: missing %q in %q", key, i, kvSep, pair)
+		}
+		k, err := parseK(fastTrim(rawK))
+		if err != nil {
+			return defaultValue, fmt.Errorf("%s[%d]: key: %w", key, i, err)
+		}
+		val, err := parseV(fastTrim(rawV))
+		if err != nil {
+			return defaultValue, fmt.Errorf("%s[%d]: value: %w", key, i, err)
+		}
+		m[k] = val
+	}
+	return m, nil
+}
+
+// IndexedSlice collects the values of prefix_0, prefix_1, ... in index
+// order, stopping at the first index that is not set.
+func IndexedSlice(prefix string) []string {
+	var values []string
+	for i := 0; ; i++ {
+		v, ok := lookupEnv(prefix + "_" + strconv.Itoa(i))
+		if !ok {
+			return values
+		}
+		values = append(values, TrimFunc(v))
 	}
-	return defaultValue
 }
 
 // Int returns the integer value represented by the string.
+// It parses with strconv.Atoi, so the accepted range is that of int on
+// the current platform: 32 bits on 386 and arm, 64 bits on amd64 and
+// arm64. A value such as 3000000000 therefore parses on 64-bit
+// platforms but overflows on 32-bit ones. Use IntBits to pin the range.
 func Int(key string, defaultValue int) (int, error) {
 	v := Get(key, "")
 	if v == "" {
@@ -50,6 +528,131 @@ func Int(key string, defaultValue int) (int, error) {
 	return strconv.Atoi(v)
 }
 
+// StrictInt returns the integer value represented by the string.
+// After surrounding spaces are trimmed the value must match
+// [+-]?[0-9]+ exactly: underscores, base prefixes, units and any
+// other trailing characters are rejected, as are values that do
+// not fit in T.
+func StrictInt[T constraints.Integer](key string, defaultValue T) (T, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	n, err := parseInteger[T](v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+// IntRange returns the integer value represented by the string,
+// checking that it lies within [min, max]. The default value is
+// returned when the key is not set.
+func IntRange[T constraints.Integer](key string, min, max, defaultValue T) (T, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	n, err := parseInteger[T](v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	if n < min || n > max {
+		return defaultValue, fmt.Errorf("%s: value %d out of range [%d, %d]", key, n, min, max)
+	}
+	return n, nil
+}
+
+// EnumGet returns the integer value represented by the string as a T,
+// checking that it is a valid index into mapping, whose elements name
+// the values: with mapping []string{"json", "text"}, LOG_FORMAT=1
+// selects text. The default value is returned when the key is not set.
+func EnumGet[T ~int](key string, mapping []string, defaultValue T) (T, error) {
+	n, err := Int(key, int(defaultValue))
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	if n < 0 || n >= len(mapping) {
+		return defaultValue, fmt.Errorf("%s: value %d out of range [0, %d] (%s)",
+			key, n, len(mapping)-1, strings.Join(mapping, ", "))
+	}
+	return T(n), nil
+}
+
+// IntBits is like StrictInt but limits the value to a bits-wide
+// integer, signed or unsigned as T is, so overflow behaves the same on
+// every platform: IntBits[int](key, 32, 0) rejects 3000000000 on 32-
+// and 64-bit platforms alike. bits must be between 1 and the size of T.
+func IntBits[T constraints.Integer](key string, bits int, defaultValue T) (T, error) {
+	if bits < 1 || bits > intBitSize[T]() {
+		return defaultValue, fmt.Errorf("%s: bit size %d out of range [1, %d]", key, bits, intBitSize[T]())
+	}
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	n, err := parseIntegerBits[T](v, bits)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+// parseInteger parses s as a base 10 integer of type T.
+func parseInteger[T constraints.Integer](s string) (T, error) {
+	return parseIntegerBits[T](s, intBitSize[T]())
+}
+
+// parseIntegerBits parses s as a base 10 integer of type T that fits
+// in bits bits.
+func parseIntegerBits[T constraints.Integer](s string, bits int) (T, error) {
+	digits := s
+	if len(digits) > 0 && (digits[0] == '+' || digits[0] == '-') {
+		digits = digits[1:]
+	}
+	if digits == "" {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, fmt.Errorf("invalid integer %q", s)
+		}
+	}
+
+	if ^T(0) < 0 {
+		n, err := strconv.ParseInt(s, 10, bits)
+		return T(n), err
+	}
+	if s[0] == '+' {
+		s = s[1:]
+	}
+	n, err := strconv.ParseUint(s, 10, bits)
+	return T(n), err
+}
+
+// intBitSize returns the bit size of T. Using the size of the type
+// rather than a type switch also covers named types such as
+// type Level int8.
+func intBitSize[T constraints.Integer]() int {
+	var v T
+	return int(unsafe.Sizeof(v)) * 8
+}
+
+// Complex returns the complex number represented by the string, such
+// as "3+4i", "2.5" or "4i", as parsed by strconv.ParseComplex. The
+// default value is returned when the key is not set.
+func Complex(key string, defaultValue complex128) (complex128, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	c, err := strconv.ParseComplex(v, 128)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return c, nil
+}
+
 // Duration returns a parsed time.Duration if found in
 // the environment value, returns the default value duration
 // otherwise.
@@ -61,11 +664,82 @@ func Duration(key string, defaultValue time.Duration) (time.Duration, error) {
 	return time.ParseDuration(v)
 }
 
+// Timezone returns the location named by an IANA time zone name such
+// as "America/New_York", as loaded by time.LoadLocation. The default
+// value is returned when the key is not set. An unknown name, or a
+// time zone database missing on the system, results in an error.
+func Timezone(key string, defaultValue *time.Location) (*time.Location, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: invalid time zone %q: %w", key, v, err)
+	}
+	return loc, nil
+}
+
+// FileMode returns the Unix permission bits represented by the octal
+// string, such as 0644, 0o755 or 644. The setuid, setgid and sticky
+// bits (04000, 02000, 01000) map to the corresponding os.FileMode
+// flags; larger values are rejected.
+func FileMode(key string, defaultValue os.FileMode) (os.FileMode, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(v, "0o"), "0O")
+	n, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil || digits == "" {
+		return defaultValue, fmt.Errorf("%s: invalid octal file mode %q", key, v)
+	}
+	if n > 0o7777 {
+		return defaultValue, fmt.Errorf("%s: file mode %q out of range", key, v)
+	}
+
+	mode := os.FileMode(n) & os.ModePerm
+	if n&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if n&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if n&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// JSON decodes the JSON value of key into target and reports whether
+// the key was set. When it is not set target is left untouched.
+func JSON(key string, target any) (bool, error) {
+	v := Get(key, "")
+	if v == "" {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(v), target); err != nil {
+		return true, fmt.Errorf("%s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Load reads the given files (".env" by default) and sets every
+// variable that is not already present in the environment.
+//
+// KEY="" and KEY= are equivalent: both set KEY to the empty string,
+// so os.LookupEnv reports KEY as present while IsSet, which treats
+// empty values as unset, reports false just as for an absent key.
 func Load(filenames ...string) (err error) {
+	_, err = LoadReport(filenames...)
+	return
+}
+
+func Overload(filenames ...string) (err error) {
 	filenames = filenamesOrDefault(filenames)
 
 	for _, filename := range filenames {
-		err = loadFile(filename, false)
+		_, err = loadFile(filename, LoadOptions{Overload: true})
 		if err != nil {
 			return // return early on a spazout
 		}
@@ -73,39 +747,643 @@ func Load(filenames ...string) (err error) {
 	return
 }
 
-func Overload(filenames ...string) (err error) {
+// LoadPrecedence loads the given files (".env" by default) so that the
+// first file listed has the highest priority. Files are loaded in
+// reverse order with overload semantics, so a key defined in several
+// files takes its value from the earliest of them.
+//
+// This differs from Load, where process variables and earlier files
+// win because nothing already set is replaced, and from Overload, where
+// the last file wins. Like Overload, LoadPrecedence replaces variables
+// already present in the process environment.
+func LoadPrecedence(filenames ...string) error {
 	filenames = filenamesOrDefault(filenames)
+	for i := len(filenames) - 1; i >= 0; i-- {
+		if _, err := loadFile(filenames[i], LoadOptions{Overload: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shadowed returns the sorted keys defined in the given files (".env"
+// by default) that are already present in the environment. Load leaves
+// these keys untouched, so edits to them in the files have no effect.
+func Shadowed(filenames ...string) ([]string, error) {
+	currentEnv := currentEnvKeys()
+	seen := map[string]bool{}
+	var shadowed []string
+	for _, filename := range filenamesOrDefault(filenames) {
+		envMap, err := readFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		for key := range envMap {
+			if currentEnv[key] && !seen[key] {
+				seen[key] = true
+				shadowed = append(shadowed, key)
+			}
+		}
+	}
+	sort.Strings(shadowed)
+	return shadowed, nil
+}
+
+// LoadOptions controls how LoadWithOptions applies parsed files
+// to the environment.
+type LoadOptions struct {
+	// Overload replaces variables that are already set, like Overload.
+	Overload bool
+
+	// KeyTransform, if not nil, rewrites every parsed key before it is
+	// checked against the current environment and set. Files loaded
+	// with a KeyTransform may also use '-' in key names, as in
+	// my-app.db-host, for the transform to rewrite.
+	KeyTransform func(string) string
+
+	// AddPrefix is prepended to every parsed key after KeyTransform
+	// has run, so several applications can share one file without
+	// their keys colliding: HOST=x loaded with AddPrefix "SVC_" sets
+	// SVC_HOST. AllowedKeys and ForbiddenKeys match prefixed keys.
+	AddPrefix string
+
+	// AppendKeys lists keys whose values accumulate instead of being
+	// replaced or skipped: a value read for one of these keys is
+	// appended to the current value, if any, joined by
+	// AppendSeparator. Values therefore end up in load order, with a
+	// value already present in the process environment first.
+	AppendKeys []string
+
+	// AppendSeparator joins accumulated AppendKeys values.
+	// It defaults to ",".
+	AppendSeparator string
+
+	// AllowedKeys, if not empty, restricts loading to the listed keys.
+	// Other keys are skipped silently.
+	AllowedKeys []string
+
+	// ForbiddenKeys lists keys that are never loaded. Skipping one
+	// logs a warning through the standard logger; the other keys of
+	// the file are still loaded.
+	ForbiddenKeys []string
+
+	// LineFunc, if not nil, rewrites every raw line of the files before
+	// it is parsed, for example to apply templating. It runs before and
+	// independently of variable expansion, which sees its output. An
+	// error aborts the load and is reported with the line number.
+	LineFunc func(line string) (string, error)
+
+	// ParseOptions, if not nil, controls how the files are parsed,
+	// for example to enable sections or choose an ExpandScope. Nil
+	// parses like Load: variables are expanded and values trimmed.
+	ParseOptions *ParseOptions
+
+	// Decoder is the character encoding of the files, such as
+	// charmap.ISO8859_1 for Latin-1. Files are transcoded to UTF-8
+	// before parsing. Nil means the files already are UTF-8.
+	Decoder encoding.Encoding
+}
+
+// LoadOption configures LoadOptions.
+type LoadOption func(*LoadOptions)
+
+// NewLoadOptions returns LoadOptions configured by opts.
+func NewLoadOptions(opts ...LoadOption) LoadOptions {
+	var o LoadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithKeyWhitelist restricts loading to the allowed keys, which is
+// useful for files from untrusted sources.
+func WithKeyWhitelist(allowed ...string) LoadOption {
+	return func(o *LoadOptions) {
+		o.AllowedKeys = append(o.AllowedKeys, allowed...)
+	}
+}
+
+// WithKeyBlacklist prevents the forbidden keys from being loaded.
+func WithKeyBlacklist(forbidden ...string) LoadOption {
+	return func(o *LoadOptions) {
+		o.ForbiddenKeys = append(o.ForbiddenKeys, forbidden...)
+	}
+}
+
+// LoadWithOptions loads the given files (".env" by default) using
+// opts, in order, returning early on the first error.
+func LoadWithOptions(opts LoadOptions, filenames ...string) error {
+	for _, filename := range filenamesOrDefault(filenames) {
+		if _, err := loadFile(filename, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FromArgs sets variables from KEY=VALUE pairs such as the ones passed
+// on a command line, typically FromArgs(os.Args[1:], false). Elements
+// without an "=", or with an empty key such as "=foo", are skipped; the
+// pair is split on the first "=" and both halves are trimmed. Existing variables are only replaced when
+// overload is true.
+func FromArgs(args []string, overload bool) error {
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			continue
+		}
+		key = fastTrim(key)
+		if key == "" {
+			continue
+		}
+		if _, exists := os.LookupEnv(key); exists && !overload {
+			continue
+		}
+		if err := os.Setenv(key, fastTrim(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirExtensions lists the file extensions ReadDir picks up. The empty
+// string matches files without an extension.
+var DirExtensions = []string{".env"}
+
+// ReadDir loads every regular file in dir whose extension is listed in
+// DirExtensions, in lexicographic order of file name. Every file is
+// attempted; the returned error joins the errors of all files that
+// failed to load.
+func ReadDir(dir string, overload bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
 
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !hasDirExtension(entry.Name()) {
+			continue
+		}
+		if _, err := loadFile(filepath.Join(dir, entry.Name()), LoadOptions{Overload: overload}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func hasDirExtension(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range DirExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve builds the effective configuration without touching the
+// environment. Values are layered, lowest precedence first: defaults,
+// then the given files in order, so later files override earlier
+// ones, then the process environment. Only keys that appear in
+// defaults or in one of the files are returned.
+func Resolve(defaults map[string]string, filenames ...string) (map[string]string, error) {
+	layers := []map[string]string{defaults}
 	for _, filename := range filenames {
-		err = loadFile(filename, true)
+		envMap, err := readFile(filename)
 		if err != nil {
-			return // return early on a spazout
+			return nil, err
 		}
+		layers = append(layers, envMap)
 	}
-	return
+	resolved := Merge(layers...)
+	for key := range resolved {
+		if v, ok := os.LookupEnv(key); ok {
+			resolved[key] = v
+		}
+	}
+	return resolved, nil
+}
+
+// Parse is ParseDotenvReader under a shorter name.
+func Parse(r io.Reader, opts ParseOptions) (map[string]string, error) {
+	return ParseDotenvReader(r, opts)
+}
+
+// ParseDotenvReader reads dotenv-formatted content from r and returns
+// the parsed variables, applying opts exactly as given. It has no side
+// effects. Pass Expand and TrimValues as true to parse like Load does.
+func ParseDotenvReader(r io.Reader, opts ParseOptions) (map[string]string, error) {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+	envMap := map[string]string{}
+	if err := parseBytes(buf.Bytes(), envMap, opts); err != nil {
+		return nil, err
+	}
+	return envMap, nil
+}
+
+// ParseLine parses a single dotenv line, handling quotes, inline
+// comments, the export prefix and either separator as Load does. ok
+// is false, with no error, for blank and comment lines. References to
+// other variables are resolved against the process environment, since
+// there is no file to look in.
+func ParseLine(line string) (key, value string, ok bool, err error) {
+	src := getStatementStart([]byte(line), charComment)
+	if src == nil {
+		return "", "", false, nil
+	}
+	if bare, isBare := bareLine(src, 0); isBare {
+		return "", "", false, fmt.Errorf("missing separator in %q", bare)
+	}
+	key, rest, err := locateKeyName(src, 0, false)
+	if err != nil {
+		return "", "", false, err
+	}
+	value, rest, err = extractVarValue(rest, map[string]string{}, defaultParseOptions)
+	if err != nil {
+		return "", "", false, err
+	}
+	if getStatementStart(rest, charComment) != nil {
+		return "", "", false, fmt.Errorf("unexpected content after value of %s", key)
+	}
+	return key, value, true, nil
+}
+
+// Validate checks the syntax of a dotenv file without loading it. The
+// file is parsed strictly: lines without a separator, keys defined more
+// than once and invalid key names are errors. The first problem found
+// is returned with its line number, and nil if the file is clean. Use
+// ValidateStruct to check the loaded values themselves.
+func Validate(filename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	opts := defaultParseOptions
+	opts.ErrorOnBareLine, opts.ErrorOnDuplicate, opts.StrictKeys = true, true, true
+	if err := parseBytes(src, map[string]string{}, opts); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// Merge combines the given maps into a new map. Maps are applied in
+// order, so when a key is present in more than one map the value from
+// the last map wins. None of the input maps are modified.
+func Merge(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// EnvMap returns the current environment as a map. Values are
+// returned exactly as stored, without trimming.
+func EnvMap() map[string]string {
+	envMap := map[string]string{}
+	for _, e := range os.Environ() {
+		key, value, _ := strings.Cut(e, "=")
+		envMap[key] = value
+	}
+	return envMap
+}
+
+// ToSlice returns the current environment as KEY=VALUE strings sorted
+// by key, in the format expected by exec.Cmd.Env.
+func ToSlice() []string {
+	return ToSliceWithPrefix("")
+}
+
+// ToSliceWithPrefix is like ToSlice but only includes keys starting
+// with prefix, and strips the prefix from them. A key equal to the
+// prefix is skipped.
+func ToSliceWithPrefix(prefix string) []string {
+	envMap := EnvMap()
+	var env []string
+	for _, key := range SortedKeys(prefix) {
+		name := strings.TrimPrefix(key, prefix)
+		if name == "" {
+			continue
+		}
+		env = append(env, name+"="+envMap[key])
+	}
+	return env
+}
+
+// SortedKeys returns the keys of the environment sorted alphabetically.
+// If a prefix is given only keys starting with it are returned.
+func SortedKeys(prefix ...string) []string {
+	p := ""
+	if len(prefix) > 0 {
+		p = prefix[0]
+	}
+	var keys []string
+	for _, e := range os.Environ() {
+		key, _, _ := strings.Cut(e, "=")
+		if strings.HasPrefix(key, p) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ClearPrefix unsets every variable whose key starts with prefix. All
+// keys are attempted; the first error encountered is returned.
+func ClearPrefix(prefix string) error {
+	var firstErr error
+	for _, key := range SortedKeys(prefix) {
+		if err := os.Unsetenv(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ClearFile unsets every key defined in filename, for example to tear
+// down what Load set in a test. It is unconditional: a key is removed
+// even if it was not set by this package, so values inherited from the
+// parent process are lost too when the file defines the same keys. All
+// keys are attempted; the first error encountered is returned.
+func ClearFile(filename string) error {
+	envMap, err := readFile(filename)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for key := range envMap {
+		if err := os.Unsetenv(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ExpandAll resolves ${VAR} and $VAR references in the values of
+// keys and writes the expanded values back. With no keys, every
+// variable in EnvMap is expanded, inherited ones included, so a $ that
+// must stay literal has to be escaped as \$. With keys, only the
+// listed keys are rewritten; other variables are read as is.
+//
+// Each key is expanded only after every key being expanded that it
+// refers to, so chains of references resolve fully regardless of
+// order, and the value of a reference is substituted verbatim rather
+// than expanded again. References to unset variables expand to the
+// empty string. A cycle of references (A refers to B, B refers to A)
+// is reported as an error before anything is written.
+//
+// Escapes are consumed by the expansion: \$x is written back as $x,
+// which a second call would expand.
+func ExpandAll(keys ...string) error {
+	envMap := EnvMap()
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(envMap))
+		for key := range envMap {
+			keys = append(keys, key)
+		}
+	}
+	pending := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := envMap[key]; ok {
+			pending[key] = true
+		}
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+
+	var resolve func(key string, path []string) error
+	resolve = func(key string, path []string) error {
+		switch state[key] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("reference cycle: %s -> %s", strings.Join(path, " -> "), key)
+		}
+		state[key] = visiting
+		for _, ref := range variableRefs(envMap[key]) {
+			if !pending[ref] {
+				continue
+			}
+			if err := resolve(ref, append(path, key)); err != nil {
+				return err
+			}
+		}
+		envMap[key] = expandVariables(envMap[key], func(k string) string { return envMap[k] })
+		state[key] = done
+		return nil
+	}
+
+	for key := range pending {
+		if err := resolve(key, nil); err != nil {
+			return err
+		}
+	}
+
+	for key := range pending {
+		if v, _ := os.LookupEnv(key); v != envMap[key] {
+			if err := os.Setenv(key, envMap[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PrintEnv writes a KEY=VALUE line for each of keys to w, or for every
+// variable in the environment, sorted by key, when no keys are given.
+// Keys that are not set are skipped and values of keys registered
+// with MarkSensitive are masked. Values containing line breaks, double
+// quotes or backslashes are double-quoted and escaped as Marshal does,
+// so every variable stays on one line.
+func PrintEnv(w io.Writer, keys ...string) error {
+	envMap := EnvMap()
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(envMap))
+		for key := range envMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	for _, key := range keys {
+		value, ok := envMap[key]
+		if !ok {
+			continue
+		}
+		if IsSensitive(key) {
+			value = maskedValue
+		} else if strings.ContainsAny(value, "\n\r\"\\") {
+			value = `"` + doubleQuoteEscape(value) + `"`
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, value); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Marshal outputs the given environment as a dotenv-formatted environment file.
 // Each line is in the format: KEY="VALUE" where VALUE is backslash-escaped.
+// Lines are ordered by key.
 func Marshal() (string, error) {
-	var envMap = map[string]string{}
+	return MarshalWithOptions(MarshalOptions{})
+}
 
-	for _, e := range os.Environ() {
-		pair := strings.Split(e, "=")
-		envMap[pair[0]] = fastTrim(os.Getenv(pair[0]))
+// MarshalMasked is like Marshal but replaces the values of
+// sensitiveKeys, and of keys registered with MarkSensitive, with a
+// mask. The output remains valid dotenv syntax, so it is safe to log.
+func MarshalMasked(sensitiveKeys []string) (string, error) {
+	masked := make(map[string]bool, len(sensitiveKeys))
+	for _, k := range sensitiveKeys {
+		masked[k] = true
 	}
-	lines := make([]string, 0, len(envMap))
+	envMap := EnvMap()
 	for k, v := range envMap {
-		if d, err := strconv.Atoi(v); err == nil {
-			lines = append(lines, fmt.Sprintf(`%s=%d`, k, d))
+		if masked[k] || IsSensitive(k) {
+			envMap[k] = maskedValue
 		} else {
-			lines = append(lines, fmt.Sprintf(`%s="%s"`, k, doubleQuoteEscape(v)))
+			envMap[k] = fastTrim(v)
 		}
 	}
-	sort.Strings(lines)
+	return marshalMap(envMap), nil
+}
+
+// MarshalOptions controls MarshalWithOptions.
+type MarshalOptions struct {
+	// ValueFormat returns the text written after KEY= for a value,
+	// including any quotes, so callers can control quoting per key.
+	// It defaults to DefaultValueFormat.
+	ValueFormat func(key, value string) string
+}
+
+// MarshalWithOptions is like Marshal but formats values as opts says.
+func MarshalWithOptions(opts MarshalOptions) (string, error) {
+	format := opts.ValueFormat
+	if format == nil {
+		format = DefaultValueFormat
+	}
+	envMap := EnvMap()
+	for k, v := range envMap {
+		envMap[k] = fastTrim(v)
+	}
+	return marshalMapFormat(envMap, format), nil
+}
+
+// DefaultValueFormat is the value format used by Marshal: integers are
+// written as is and everything else double-quoted and backslash-escaped.
+func DefaultValueFormat(key, value string) string {
+	if d, err := strconv.Atoi(value); err == nil {
+		return strconv.Itoa(d)
+	}
+	return `"` + doubleQuoteEscape(value) + `"`
+}
+
+// quoteValue double-quotes and backslash-escapes every value, numbers
+// included, so it reads back exactly as written: unlike
+// DefaultValueFormat it keeps leading zeros and signs.
+func quoteValue(_, value string) string {
+	return `"` + doubleQuoteEscape(value) + `"`
+}
+
+// marshalMap formats m as dotenv lines sorted by key.
+func marshalMap(m map[string]string) string {
+	return marshalMapFormat(m, DefaultValueFormat)
+}
+
+func marshalMapFormat(m map[string]string, format func(key, value string) string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+"="+format(k, m[k]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MarshalExample outputs every key of the current environment, sorted,
+// with an empty value (KEY=), one per line. It is meant for generating
+// a .env.example template that documents the expected configuration
+// without leaking real values.
+func MarshalExample() (string, error) {
+	keys := SortedKeys()
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		lines = append(lines, k+"=")
+	}
 	return strings.Join(lines, "\n"), nil
 }
 
+// MarshalShell outputs the environment as POSIX shell export
+// statements, one per line in the format: export KEY='VALUE', sorted by
+// key, suitable for eval "$(...)". Single quotes inside values are
+// escaped by closing the quoted string, adding an escaped quote and
+// reopening it. Keys that are not valid shell variable names are skipped.
+func MarshalShell() (string, error) {
+	return marshalShellMap(EnvMap()), nil
+}
+
+func marshalShellMap(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if isShellName(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("export %s=%s", k, shellQuote(m[k])))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// EncodeForShell returns the value of key in single quotes, with
+// embedded single quotes escaped the same way as MarshalShell, so it
+// can be pasted into a shell script as export KEY=<result> without
+// any expansion or injection. An unset key yields an empty quoted
+// string.
+func EncodeForShell(key string) string {
+	return shellQuote(Get(key, ""))
+}
+
+// shellQuote wraps s in single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// isShellName reports whether s matches [A-Za-z_][A-Za-z0-9_]*.
+func isShellName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 const doubleQuoteSpecialChars = "\\\n\r\"!$`"
 
 func doubleQuoteEscape(line string) string {
@@ -128,43 +1406,178 @@ func filenamesOrDefault(filenames []string) []string {
 	return filenames
 }
 
-func loadFile(filename string, overload bool) error {
-	envMap, err := readFile(filename)
+func loadFile(filename string, opts LoadOptions) (FileReport, error) {
+	parseOpts := defaultParseOptions
+	if opts.ParseOptions != nil {
+		parseOpts = *opts.ParseOptions
+	}
+	parseOpts.dashedKeys = opts.KeyTransform != nil
+	envMap, err := readEncodedFile(filename, opts.Decoder, opts.LineFunc, parseOpts)
 	if err != nil {
-		return err
+		return FileReport{Filename: filename}, err
 	}
+	return applyEnvMap(envMap, filename, opts), nil
+}
 
-	currentEnv := map[string]bool{}
-	rawEnv := os.Environ()
-	for _, rawEnvLine := range rawEnv {
-		key := strings.Split(rawEnvLine, "=")[0]
-		currentEnv[key] = true
+// applyEnvMap sets the parsed variables in envMap according to opts,
+// recording source as where they came from, and reports what it did.
+func applyEnvMap(envMap map[string]string, source string, opts LoadOptions) FileReport {
+	report := FileReport{Filename: source}
+	currentEnv := currentEnvKeys()
+
+	appendKeys := map[string]bool{}
+	for _, key := range opts.AppendKeys {
+		appendKeys[key] = true
+	}
+	sep := opts.AppendSeparator
+	if sep == "" {
+		sep = ","
+	}
+
+	allowed := map[string]bool{}
+	for _, key := range opts.AllowedKeys {
+		allowed[key] = true
+	}
+	forbidden := map[string]bool{}
+	for _, key := range opts.ForbiddenKeys {
+		forbidden[key] = true
 	}
 
 	for key, value := range envMap {
-		if !currentEnv[key] || overload {
+		if opts.KeyTransform != nil {
+			key = opts.KeyTransform(key)
+		}
+		key = opts.AddPrefix + key
+		if len(allowed) > 0 && !allowed[key] {
+			report.KeysSkipped++
+			continue
+		}
+		if forbidden[key] {
+			log.Printf("goenv: skipping forbidden key %s from %s", key, source)
+			report.KeysSkipped++
+			continue
+		}
+		if appendKeys[key] {
+			if current := os.Getenv(key); current != "" {
+				value = current + sep + value
+			}
+			_ = os.Setenv(key, value)
+			recordSource(key, value, source)
+			report.count(currentEnv[key])
+			continue
+		}
+		if !currentEnv[key] || opts.Overload {
 			_ = os.Setenv(key, value)
+			recordSource(key, value, source)
+			report.count(currentEnv[key])
+		} else {
+			report.KeysSkipped++
 		}
 	}
+	return report
+}
 
-	return nil
+// currentEnvKeys returns the set of keys present in the environment.
+func currentEnvKeys() map[string]bool {
+	currentEnv := map[string]bool{}
+	rawEnv := os.Environ()
+	for _, rawEnvLine := range rawEnv {
+		key := strings.Split(rawEnvLine, "=")[0]
+		currentEnv[key] = true
+	}
+	return currentEnv
 }
 
+// maxLineSize limits the length of a single line read by readFile.
+const maxLineSize = 16 << 20
+
 func readFile(filename string) (envMap map[string]string, err error) {
+	return readEncodedFile(filename, nil, nil, defaultParseOptions)
+}
+
+// readEncodedFile parses filename with opts line by line rather than
+// reading it whole, transcoding it from enc to UTF-8 first unless enc
+// is nil.
+// Every raw line is passed through lineFunc, if not nil, before it is
+// parsed. Lines are handed to the parser one statement at a time, once
+// a statementScanner sees the statement is complete, so a multi-line
+// value is parsed once rather than once per line.
+func readEncodedFile(filename string, enc encoding.Encoding, lineFunc func(string) (string, error), opts ParseOptions) (envMap map[string]string, err error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return
 	}
 	defer file.Close()
 
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, file)
-	if err != nil {
-		return nil, err
+	var r io.Reader = file
+	if enc != nil {
+		r = transform.NewReader(file, enc.NewDecoder())
 	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	scanner.Split(scanLines)
+
 	envMap = map[string]string{}
-	err = parseBytes(buf.Bytes(), envMap)
-	return
+	p := newParser(envMap, opts)
+	sc := statementScanner{opts: opts}
+	var statement []byte
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Bytes()
+		if lineFunc != nil {
+			transformed, err := lineFunc(string(line))
+			if err != nil {
+				return nil, &lineError{lineNo, err}
+			}
+			line = []byte(transformed)
+		}
+		statement = append(statement, line...)
+		statement = append(statement, '\n')
+		if !sc.feed(line) {
+			continue
+		}
+		if err = p.parse(statement); err != nil {
+			return nil, err
+		}
+		statement = statement[:0]
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(statement) > 0 {
+		// the file ended inside a quoted value or a continued line
+		if err = p.parse(statement); err != nil {
+			return nil, err
+		}
+	}
+	return envMap, nil
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines that also ends
+// lines on a standalone \r, as the parser does.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// need the next byte to tell \r from \r\n
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
 }
 
 func fastTrim(s string) string {
@@ -191,3 +1604,19 @@ func fastTrim(s string) string {
 	}
 	return s[start:end]
 }
+
+// TrimUnicodeSpace trims leading and trailing Unicode whitespace, as
+// defined by unicode.IsSpace, including no-break spaces (U+00A0) that
+// sneak into values pasted from documents. Values that neither start
+// nor end with a space or non-ASCII byte are returned without further
+// work. It can be used as TrimFunc.
+func TrimUnicodeSpace(s string) string {
+	if s == "" {
+		return s
+	}
+	first, last := s[0], s[len(s)-1]
+	if first < utf8.RuneSelf && !unicode.IsSpace(rune(first)) && last < utf8.RuneSelf && !unicode.IsSpace(rune(last)) {
+		return s
+	}
+	return strings.TrimFunc(s, unicode.IsSpace)
+}
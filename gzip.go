@@ -0,0 +1,42 @@
+package goenv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LoadGzip is like Load but accepts gzip-compressed files. Compression
+// is detected from the gzip magic bytes, so plain-text files load too.
+func LoadGzip(filenames ...string) error {
+	for _, filename := range filenamesOrDefault(filenames) {
+		envMap, err := readGzipFile(filename)
+		if err != nil {
+			return err
+		}
+		applyEnvMap(envMap, filename, LoadOptions{})
+	}
+	return nil
+}
+
+func readGzipFile(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	br := bufio.NewReader(file)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return Parse(r, defaultParseOptions)
+}
@@ -0,0 +1,22 @@
+package goenv
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// LanguageTag returns the BCP 47 language tag represented by the
+// string, such as "en-US", as parsed by language.Parse. The default
+// value is returned when the key is not set.
+func LanguageTag(key string, defaultValue language.Tag) (language.Tag, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	tag, err := language.Parse(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return tag, nil
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -17,44 +19,378 @@ const (
 	exportPrefix = "export"
 )
 
-func parseBytes(src []byte, out map[string]string) error {
-	src = bytes.Replace(src, []byte("\r\n"), []byte("\n"), -1)
+// errUnterminatedQuote is returned for a quoted value without a closing quote.
+var errUnterminatedQuote = errors.New("unterminated quoted value")
+
+// ParseOptions controls the parser. The zero value neither expands
+// variables nor trims values; the Load family always expands and
+// trims, and ParseDotenvReader does the same when Expand and
+// TrimValues are set.
+type ParseOptions struct {
+	// Sections enables INI-style [section] headers. Keys that follow
+	// a header are prefixed with the section name, upper-cased and with
+	// every character outside [A-Z0-9] replaced by an underscore, and
+	// an underscore separator: HOST under [database] becomes
+	// DATABASE_HOST. An empty header [] ends the current section.
+	Sections bool
+
+	// Expand replaces ${VAR} and $VAR references in unquoted and
+	// double-quoted values with the value of VAR, looked up according
+	// to ExpandScope.
+	Expand bool
+
+	// ExpandScope controls where Expand looks variables up.
+	ExpandScope ExpandScope
+
+	// TrimValues strips the whitespace surrounding unquoted values.
+	// Without it, everything between the separator and the end of the
+	// line, or an inline comment, is kept verbatim.
+	TrimValues bool
+
+	// CommentChar starts comment lines and inline comments.
+	// It defaults to '#'.
+	CommentChar rune
+
+	// Separator selects the key/value separator: SeparatorAuto, the
+	// default, SeparatorEquals or SeparatorColon. With SeparatorAuto
+	// the first '=' or ':' after the key wins, so TIME:12:30 sets TIME
+	// to 12:30 and URL=http://x sets URL to http://x. Forcing one
+	// separator makes a line using the other an error.
+	Separator rune
+
+	// IgnoreInvalid skips lines that cannot be parsed instead of
+	// failing on them.
+	IgnoreInvalid bool
+
+	// ErrorOnBareLine rejects statements without a separator, such as
+	// a stray JUST_A_WORD line, with an error naming the line number.
+	// It takes precedence over IgnoreInvalid.
+	ErrorOnBareLine bool
+
+	// ErrorOnDuplicate rejects a key defined more than once instead of
+	// letting the last definition win.
+	ErrorOnDuplicate bool
+
+	// StrictKeys rejects empty key names and key names containing
+	// whitespace, such as "MY KEY", which are otherwise accepted.
+	StrictKeys bool
+
+	// dashedKeys also accepts '-' in key names. LoadWithOptions sets
+	// it when a KeyTransform can rewrite such keys into valid names.
+	dashedKeys bool
+}
+
+// ExpandScope selects where ${VAR} references are resolved.
+type ExpandScope int
+
+const (
+	// FileThenProcess resolves a reference against the variables
+	// defined earlier in the same file, falling back to the process
+	// environment. It is the default.
+	FileThenProcess ExpandScope = iota
+
+	// ProcessOnly resolves references against the process environment
+	// only, so earlier lines of the file can never shadow a variable
+	// that is already set.
+	ProcessOnly
+
+	// FileOnly resolves references against the variables defined
+	// earlier in the same file only. Anything else expands to the
+	// empty string.
+	FileOnly
+)
+
+// Values for ParseOptions.Separator.
+const (
+	SeparatorAuto   rune = 0
+	SeparatorEquals rune = '='
+	SeparatorColon  rune = ':'
+)
+
+// defaultParseOptions are the options used when loading files.
+var defaultParseOptions = ParseOptions{Expand: true, TrimValues: true}
+
+// expandLookup returns the function resolving references for values
+// parsed into vars.
+func (o ParseOptions) expandLookup(vars map[string]string) func(string) string {
+	switch o.ExpandScope {
+	case ProcessOnly:
+		return os.Getenv
+	case FileOnly:
+		return func(key string) string { return vars[key] }
+	default:
+		return func(key string) string {
+			if v, ok := vars[key]; ok {
+				return v
+			}
+			return os.Getenv(key)
+		}
+	}
+}
+
+func (o ParseOptions) commentChar() rune {
+	if o.CommentChar == 0 {
+		return charComment
+	}
+	return o.CommentChar
+}
+
+func parseBytes(src []byte, out map[string]string, opts ParseOptions) error {
+	return newParser(out, opts).parse(src)
+}
+
+// parser parses dotenv content into out. Content can be fed in
+// consecutive chunks of whole statements: the current section, the
+// keys seen so far and the line count carry over from one chunk to
+// the next.
+type parser struct {
+	opts    ParseOptions
+	out     map[string]string
+	section string
+	seen    map[string]int
+	line    int // lines consumed by earlier chunks
+}
+
+func newParser(out map[string]string, opts ParseOptions) *parser {
+	p := &parser{opts: opts, out: out}
+	if opts.ErrorOnDuplicate {
+		p.seen = map[string]int{}
+	}
+	return p
+}
+
+func (p *parser) parse(src []byte) error {
+	opts := p.opts
+	// normalize Windows (\r\n) and classic Mac (\r) line endings
+	if bytes.IndexByte(src, '\r') != -1 {
+		src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+		src = bytes.ReplaceAll(src, []byte("\r"), []byte("\n"))
+	}
+	lineOf := func(rest []byte) int {
+		return p.line + bytes.Count(src[:len(src)-len(rest)], []byte("\n")) + 1
+	}
+	defer func() { p.line += bytes.Count(src, []byte("\n")) }()
+
 	cutset := src
 	for {
-		cutset = getStatementStart(cutset)
+		cutset = getStatementStart(cutset, opts.commentChar())
 		if cutset == nil {
 			// reached end of file
 			break
 		}
 
-		key, left, err := locateKeyName(cutset)
+		if opts.Sections && cutset[0] == '[' {
+			name, left, err := parseSectionHeader(cutset)
+			if err != nil {
+				return &lineError{lineOf(cutset), err}
+			}
+			p.section = name
+			cutset = left
+			continue
+		}
+
+		if opts.ErrorOnBareLine {
+			if line, ok := bareLine(cutset, opts.Separator); ok {
+				return &lineError{lineOf(cutset), fmt.Errorf("missing separator in %q", line)}
+			}
+		}
+
+		key, left, err := locateKeyName(cutset, opts.Separator, opts.dashedKeys)
 		if err != nil {
-			return err
+			if opts.IgnoreInvalid {
+				cutset = skipLine(cutset)
+				continue
+			}
+			return &lineError{lineOf(cutset), err}
+		}
+		if opts.StrictKeys && (key == "" || strings.IndexFunc(key, unicode.IsSpace) != -1) {
+			return &lineError{lineOf(cutset), fmt.Errorf("invalid key name %q", key)}
+		}
+		if p.section != "" {
+			key = p.section + "_" + key
+		}
+		if p.seen != nil {
+			if first, ok := p.seen[key]; ok {
+				return &lineError{lineOf(cutset), fmt.Errorf("duplicate key %s, first defined on line %d", key, first)}
+			}
+			p.seen[key] = lineOf(cutset)
 		}
 
-		value, left, err := extractVarValue(left, out)
+		value, left, err := extractVarValue(left, p.out, opts)
 		if err != nil {
-			return err
+			if opts.IgnoreInvalid {
+				cutset = skipLine(cutset)
+				continue
+			}
+			return &lineError{lineOf(cutset), err}
 		}
 
-		out[key] = value
+		p.out[key] = value
 		cutset = left
 	}
 
 	return nil
 }
 
+// statementScanner follows dotenv content line by line and reports
+// when the lines fed so far end on a statement boundary, so a reader
+// can hand whole statements to a parser without re-parsing them. It
+// mirrors extractVarValue: a quoted value runs until its closing
+// quote, and an unquoted value continues while its line, without the
+// inline comment, ends in a backslash.
+type statementScanner struct {
+	opts  ParseOptions
+	quote byte // quote of a value still open
+	prev  rune // last rune of an unquoted value continued on the next line
+}
+
+// feed reports whether line completes the current statement.
+func (sc *statementScanner) feed(line []byte) bool {
+	if sc.quote != 0 {
+		if closingQuote(line, 0, sc.quote) == -1 {
+			return false
+		}
+		sc.quote = 0
+		return true
+	}
+	if sc.prev != 0 {
+		sc.prev = continuedValue(line, sc.prev, sc.opts.commentChar())
+		return sc.prev == 0
+	}
+
+	trimmed := bytes.TrimLeftFunc(line, isSpace)
+	if r, _ := utf8.DecodeRune(trimmed); len(trimmed) == 0 || r == sc.opts.commentChar() ||
+		(sc.opts.Sections && r == '[') {
+		return true
+	}
+	sep := bytes.IndexAny(trimmed, "=:")
+	if sep == -1 {
+		return true
+	}
+	value := trimmed[sep+1:]
+	if quoted := bytes.TrimLeftFunc(value, isSpace); len(quoted) > 0 {
+		if q, ok := hasQuotePrefix(quoted); ok {
+			if closingQuote(quoted, 1, q) == -1 {
+				sc.quote = q
+				return false
+			}
+			return true
+		}
+		if sc.opts.TrimValues {
+			value = quoted
+		}
+	}
+	sc.prev = continuedValue(value, 0, sc.opts.commentChar())
+	return sc.prev == 0
+}
+
+// closingQuote returns the index of the quote closing a value in line,
+// searching from index from on, or -1 if the value is still open.
+func closingQuote(line []byte, from int, quote byte) int {
+	for i := from; i < len(line); i++ {
+		if line[i] != quote {
+			continue
+		}
+		if quote == prefixDoubleQuote {
+			backslashes := 0
+			for j := i - 1; j >= from && line[j] == '\\'; j-- {
+				backslashes++
+			}
+			if backslashes%2 == 1 {
+				continue
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// continuedValue checks whether the unquoted value segment seg, whose
+// value so far ends in prev (0 at the start of the value), continues
+// on the next line. It returns the last rune before the continuation
+// backslash, or 0 if the value ends here.
+func continuedValue(seg []byte, prev rune, comment rune) rune {
+	for i := 0; i < len(seg); {
+		r, size := utf8.DecodeRune(seg[i:])
+		if r == comment {
+			before := prev
+			if i > 0 {
+				before, _ = utf8.DecodeLastRune(seg[:i])
+			}
+			if before != 0 && isSpace(before) {
+				return 0
+			}
+		}
+		i += size
+	}
+	if !bytes.HasSuffix(seg, []byte{'\\'}) {
+		return 0
+	}
+	if len(seg) > 1 {
+		last, _ := utf8.DecodeLastRune(seg[:len(seg)-1])
+		return last
+	}
+	if prev != 0 {
+		return prev
+	}
+	// a value made of just a backslash; any non-space rune will do
+	return '\\'
+}
+
+// lineError annotates a parse error with the line it occurred on.
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *lineError) Unwrap() error {
+	return e.err
+}
+
+// findStatement returns the byte range of the last statement in src
+// that defines key, from the start of the key name to the end of the
+// value.
+func findStatement(src []byte, key string) (start, end int, found bool, err error) {
+	vars := map[string]string{}
+	cutset := src
+	for {
+		cutset = getStatementStart(cutset, charComment)
+		if cutset == nil {
+			return start, end, found, nil
+		}
+
+		name, left, err := locateKeyName(cutset, 0, false)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		value, left, err := extractVarValue(left, vars, defaultParseOptions)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		vars[name] = value
+
+		if name == key {
+			start, end, found = len(src)-len(cutset), len(src)-len(left), true
+		}
+		cutset = left
+	}
+}
+
 // getStatementPosition returns position of statement begin.
 //
 // It skips any comment line or non-whitespace character.
-func getStatementStart(src []byte) []byte {
+func getStatementStart(src []byte, comment rune) []byte {
 	pos := indexOfNonSpaceChar(src)
 	if pos == -1 {
 		return nil
 	}
 
 	src = src[pos:]
-	if src[0] != charComment {
+	if r, _ := utf8.DecodeRune(src); r != comment {
 		return src
 	}
 
@@ -64,11 +400,59 @@ func getStatementStart(src []byte) []byte {
 		return nil
 	}
 
-	return getStatementStart(src[pos:])
+	return getStatementStart(src[pos:], comment)
+}
+
+// bareLine reports whether the current line of src has no separator,
+// and returns the line.
+func bareLine(src []byte, sep rune) (line []byte, ok bool) {
+	line = src
+	if pos := bytes.IndexFunc(src, isLineEnd); pos != -1 {
+		line = src[:pos]
+	}
+	line = bytes.TrimRightFunc(line, isSpace)
+	if sep != 0 {
+		return line, !bytes.ContainsRune(line, sep)
+	}
+	return line, !bytes.ContainsAny(line, "=:")
+}
+
+// skipLine returns the rest of src after the current line
+func skipLine(src []byte) []byte {
+	pos := bytes.IndexByte(src, '\n')
+	if pos == -1 {
+		return nil
+	}
+	return src[pos+1:]
+}
+
+// parseSectionHeader parses a [section] header line and returns the
+// normalized section name and rest of slice
+func parseSectionHeader(src []byte) (section string, cutset []byte, err error) {
+	endOfLine := bytes.IndexFunc(src, isLineEnd)
+	if endOfLine == -1 {
+		endOfLine = len(src)
+	}
+	line := bytes.TrimRightFunc(src[:endOfLine], isSpace)
+	if line[len(line)-1] != ']' {
+		return "", nil, fmt.Errorf("unterminated section header %q", line)
+	}
+
+	name := strings.TrimFunc(string(line[1:len(line)-1]), isSpace)
+	normalized := []rune(strings.ToUpper(name))
+	for i, r := range normalized {
+		if !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			normalized[i] = '_'
+		}
+	}
+	return string(normalized), src[endOfLine:], nil
 }
 
 // locateKeyName locates and parses key name and returns rest of slice
-func locateKeyName(src []byte) (key string, cutset []byte, err error) {
+//
+// sep restricts the accepted separator to '=' or ':'; 0 accepts both.
+// dashes also accepts '-' in the key name.
+func locateKeyName(src []byte, sep rune, dashes bool) (key string, cutset []byte, err error) {
 	// trim "export" and space at beginning
 	src = bytes.TrimLeftFunc(src, isSpace)
 	if bytes.HasPrefix(src, []byte(exportPrefix)) {
@@ -90,10 +474,21 @@ loop:
 		switch char {
 		case '=', ':':
 			// library also supports yaml-style value declaration
+			if sep != 0 && rchar != sep {
+				return "", nil, fmt.Errorf(
+					`unexpected separator %q near %q, expected %q`,
+					string(char), string(src), string(sep))
+			}
 			key = string(src[0:i])
 			offset = i + 1
 			break loop
 		case '_':
+		case '-':
+			if !dashes {
+				return "", nil, fmt.Errorf(
+					`unexpected character %q in variable name near %q`,
+					string(char), string(src))
+			}
 		default:
 			// variable name should match [A-Za-z0-9_.]
 			if unicode.IsLetter(rchar) || unicode.IsNumber(rchar) || rchar == '.' {
@@ -112,49 +507,50 @@ loop:
 
 	// trim whitespace
 	key = strings.TrimRightFunc(key, unicode.IsSpace)
-	cutset = bytes.TrimLeftFunc(src[offset:], isSpace)
-	return key, cutset, nil
+	return key, src[offset:], nil
 }
 
 // extractVarValue extracts variable value and returns rest of slice
-func extractVarValue(src []byte, vars map[string]string) (value string, rest []byte, err error) {
-	quote, hasPrefix := hasQuotePrefix(src)
+func extractVarValue(src []byte, vars map[string]string, opts ParseOptions) (value string, rest []byte, err error) {
+	trimmed := bytes.TrimLeftFunc(src, isSpace)
+	quote, hasPrefix := hasQuotePrefix(trimmed)
+	if hasPrefix || opts.TrimValues {
+		src = trimmed
+	}
 	if !hasPrefix {
-		// unquoted value - read until end of line
-		endOfLine := bytes.IndexFunc(src, isLineEnd)
-
-		// Hit EOF without a trailing newline
-		if endOfLine == -1 {
-			endOfLine = len(src)
-
-			if endOfLine == 0 {
-				return "", nil, nil
+		// unquoted value - read until end of line, joining lines that
+		// end in a backslash (shell-style line continuation). A
+		// backslash inside an inline comment does not continue the line.
+		var logical []byte
+		for {
+			endOfLine := bytes.IndexFunc(src, isLineEnd)
+			if endOfLine == -1 {
+				// Hit EOF without a trailing newline
+				endOfLine = len(src)
+			}
+			start := len(logical)
+			logical = append(logical, src[:endOfLine]...)
+			src = src[endOfLine:]
+			if c := inlineCommentStart(logical, start, opts.commentChar()); c != -1 {
+				logical = logical[:c]
+				break
+			}
+			if len(src) > 0 && bytes.HasSuffix(logical, []byte{'\\'}) {
+				logical = logical[:len(logical)-1]
+				src = src[1:]
+				continue
 			}
+			break
 		}
 
-		// Convert line to rune away to do accurate countback of runes
-		line := []rune(string(src[0:endOfLine]))
-
-		// Assume end of line is end of var
-		endOfVar := len(line)
-		if endOfVar == 0 {
-			return "", src[endOfLine:], nil
+		value = string(logical)
+		if opts.TrimValues {
+			value = strings.TrimFunc(value, isSpace)
 		}
-
-		// Work backwards to check if the line ends in whitespace then
-		// a comment (ie asdasd # some comment)
-		for i := endOfVar - 1; i >= 0; i-- {
-			if line[i] == charComment && i > 0 {
-				if isSpace(line[i-1]) {
-					endOfVar = i
-					break
-				}
-			}
+		if opts.Expand {
+			value = expandVariables(value, opts.expandLookup(vars))
 		}
-
-		trimmed := strings.TrimFunc(string(line[0:endOfVar]), isSpace)
-
-		return expandVariables(trimmed, vars), src[endOfLine:], nil
+		return value, src, nil
 	}
 
 	// lookup quoted string terminator
@@ -163,18 +559,28 @@ func extractVarValue(src []byte, vars map[string]string) (value string, rest []b
 			continue
 		}
 
-		// skip escaped quote symbol (\" or \', depends on quote)
-		if prevChar := src[i-1]; prevChar == '\\' {
-			continue
+		// skip an escaped double quote; an even run of backslashes
+		// escapes itself, not the quote. Backslashes are literal inside
+		// single quotes.
+		if quote == prefixDoubleQuote {
+			backslashes := 0
+			for j := i - 1; j > 0 && src[j] == '\\'; j-- {
+				backslashes++
+			}
+			if backslashes%2 == 1 {
+				continue
+			}
 		}
 
-		// trim quotes
-		trimFunc := isCharFunc(rune(quote))
-		value = string(bytes.TrimLeftFunc(bytes.TrimRightFunc(src[0:i], trimFunc), trimFunc))
+		// strip exactly the opening and closing quote
+		value = string(src[1:i])
 		if quote == prefixDoubleQuote {
 			// unescape newlines for double quote (this is compat feature)
 			// and expand environment variables
-			value = expandVariables(expandEscapes(value), vars)
+			value = expandEscapes(value)
+			if opts.Expand {
+				value = expandVariables(value, opts.expandLookup(vars))
+			}
 		}
 
 		return value, src[i+1:], nil
@@ -186,7 +592,25 @@ func extractVarValue(src []byte, vars map[string]string) (value string, rest []b
 		valEndIndex = len(src)
 	}
 
-	return "", nil, fmt.Errorf("unterminated quoted value %s", src[:valEndIndex])
+	return "", nil, fmt.Errorf("%w %s", errUnterminatedQuote, src[:valEndIndex])
+}
+
+// inlineCommentStart returns the index of the inline comment in line,
+// looking from index from on: the first comment character that follows
+// whitespace (ie asdasd # some comment). A comment character that is
+// not preceded by whitespace (ie COLOR=#FF0000) is part of the value.
+// It returns -1 if there is none.
+func inlineCommentStart(line []byte, from int, comment rune) int {
+	for i := from; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		if r == comment && i > 0 {
+			if prev, _ := utf8.DecodeLastRune(line[:i]); isSpace(prev) {
+				return i
+			}
+		}
+		i += size
+	}
+	return -1
 }
 
 func expandEscapes(str string) string {
@@ -254,7 +678,19 @@ var (
 	unescapeCharsRegex = regexp.MustCompile(`\\([^$])`)
 )
 
-func expandVariables(v string, m map[string]string) string {
+// variableRefs returns the names of the variables referenced in v
+func variableRefs(v string) []string {
+	var refs []string
+	for _, submatch := range expandVarRegex.FindAllStringSubmatch(v, -1) {
+		if submatch[1] == "\\" || submatch[3] == "(" || submatch[4] == "" {
+			continue
+		}
+		refs = append(refs, submatch[4])
+	}
+	return refs
+}
+
+func expandVariables(v string, lookup func(string) string) string {
 	return expandVarRegex.ReplaceAllStringFunc(v, func(s string) string {
 		submatch := expandVarRegex.FindStringSubmatch(s)
 
@@ -264,7 +700,7 @@ func expandVariables(v string, m map[string]string) string {
 		if submatch[1] == "\\" || submatch[2] == "(" {
 			return submatch[0][1:]
 		} else if submatch[4] != "" {
-			return m[submatch[4]]
+			return lookup(submatch[4])
 		}
 		return s
 	})
@@ -0,0 +1,263 @@
+package goenv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSections(t *testing.T) {
+	r := require.New(t)
+	src := `
+NAME=app
+
+[database]
+HOST=localhost
+PORT=5432
+URL=${DATABASE_HOST}:${DATABASE_PORT}
+
+[ cache-v2 ]
+HOST=redis
+
+[]
+DEBUG=true
+`
+	m, err := Parse(strings.NewReader(src), ParseOptions{Expand: true, TrimValues: true, Sections: true})
+	r.NoError(err)
+	r.Equal(map[string]string{
+		"NAME":          "app",
+		"DATABASE_HOST": "localhost",
+		"DATABASE_PORT": "5432",
+		"DATABASE_URL":  "localhost:5432",
+		"CACHE_V2_HOST": "redis",
+		"DEBUG":         "true",
+	}, m)
+
+	_, err = Parse(strings.NewReader("[database\nHOST=x\n"), ParseOptions{Expand: true, TrimValues: true, Sections: true})
+	r.Error(err)
+
+	// sections are opt-in
+	_, err = Parse(strings.NewReader("[database]\nHOST=x\n"), defaultParseOptions)
+	r.Error(err)
+}
+
+func TestParseEmptyValues(t *testing.T) {
+	r := require.New(t)
+	m, err := Parse(strings.NewReader("EMPTY_A=\"\"\nEMPTY_B=\nEMPTY_D=''\n"), defaultParseOptions)
+	r.NoError(err)
+	r.Equal(map[string]string{"EMPTY_A": "", "EMPTY_B": "", "EMPTY_D": ""}, m)
+	_, ok := m["EMPTY_C"]
+	r.False(ok)
+}
+
+func TestParseInlineComments(t *testing.T) {
+	r := require.New(t)
+	src := `
+PORT=8080 # default HTTP port
+TABBED=value	# tab before comment
+COLOR=#FF0000
+ANCHOR=page#section
+TWICE=a # first # second
+QUOTED="hash # kept" # stripped
+SINGLE='hash # kept'
+EXPORTED: yaml # comment
+`
+	m, err := Parse(strings.NewReader(src), defaultParseOptions)
+	r.NoError(err)
+	r.Equal(map[string]string{
+		"PORT":     "8080",
+		"TABBED":   "value",
+		"COLOR":    "#FF0000",
+		"ANCHOR":   "page#section",
+		"TWICE":    "a",
+		"QUOTED":   "hash # kept",
+		"SINGLE":   "hash # kept",
+		"EXPORTED": "yaml",
+	}, m)
+}
+
+func TestParseDotenvReader(t *testing.T) {
+	r := require.New(t)
+	src := "HOST=localhost\nURL=  http://${HOST}  ; note\nBAD LINE\nSEP:colon\n"
+
+	m, err := ParseDotenvReader(strings.NewReader(src), ParseOptions{IgnoreInvalid: true, CommentChar: ';'})
+	r.NoError(err)
+	r.Equal(map[string]string{
+		"HOST": "localhost",
+		"URL":  "  http://${HOST}  ",
+		"SEP":  "colon",
+	}, m)
+
+	m, err = ParseDotenvReader(strings.NewReader(src), ParseOptions{
+		Expand:        true,
+		TrimValues:    true,
+		CommentChar:   ';',
+		Separator:     '=',
+		IgnoreInvalid: true,
+	})
+	r.NoError(err)
+	r.Equal(map[string]string{
+		"HOST": "localhost",
+		"URL":  "http://localhost",
+	}, m)
+
+	_, err = ParseDotenvReader(strings.NewReader(src), ParseOptions{})
+	r.Error(err)
+
+	m, err = ParseDotenvReader(strings.NewReader("# comment\n;A=1 # kept\n"), ParseOptions{CommentChar: ';', TrimValues: true})
+	r.Error(err)
+	m, err = ParseDotenvReader(strings.NewReader(";comment\nA=1 # kept\n"), ParseOptions{CommentChar: ';', TrimValues: true})
+	r.NoError(err)
+	r.Equal(map[string]string{"A": "1 # kept"}, m)
+}
+
+func TestParseLineContinuation(t *testing.T) {
+	r := require.New(t)
+	src := "LONG=part1\\\npart2\n" +
+		"SPACED=a \\\n b # comment\n" +
+		"THREE=1\\\n2\\\n3\n" +
+		"DQ=\"C:\\\\\"\n" +
+		"SQ='line\\\nnext'\n" +
+		"NEXT=ok\n" +
+		"NOTE=foo # note \\\n" +
+		"AFTER=2\n" +
+		"WIN='C:\\dir\\'\n" +
+		"END=value\\"
+	m, err := Parse(strings.NewReader(src), defaultParseOptions)
+	r.NoError(err)
+	r.Equal(map[string]string{
+		"LONG":   "part1part2",
+		"SPACED": "a  b",
+		"THREE":  "123",
+		"DQ":     `C:\`,
+		"SQ":     "line\\\nnext",
+		"NEXT":   "ok",
+		"NOTE":   "foo",
+		"AFTER":  "2",
+		"WIN":    `C:\dir\`,
+		"END":    `value\`,
+	}, m)
+}
+
+func TestParseErrorOnBareLine(t *testing.T) {
+	r := require.New(t)
+	src := "# comment\nFOO=bar\n\nJUST_A_WORD\nBAZ=qux\n"
+	_, err := Parse(strings.NewReader(src), ParseOptions{Expand: true, TrimValues: true, ErrorOnBareLine: true})
+	r.EqualError(err, `line 4: missing separator in "JUST_A_WORD"`)
+
+	_, err = Parse(strings.NewReader("FOO=bar\r\nLAST"), ParseOptions{Expand: true, TrimValues: true, ErrorOnBareLine: true})
+	r.EqualError(err, `line 2: missing separator in "LAST"`)
+
+	m, err := Parse(strings.NewReader("FOO=bar\nPORT: 80\n"), ParseOptions{Expand: true, TrimValues: true, ErrorOnBareLine: true})
+	r.NoError(err)
+	r.Equal(map[string]string{"FOO": "bar", "PORT": "80"}, m)
+
+	_, err = Parse(strings.NewReader("PORT: 80\n"), ParseOptions{Expand: true, TrimValues: true, ErrorOnBareLine: true, Separator: '='})
+	r.Error(err)
+}
+
+func TestParseExpandScope(t *testing.T) {
+	r := require.New(t)
+	t.Setenv("SCOPE_HOST", "process")
+	t.Setenv("SCOPE_ONLY_OS", "os")
+	src := "SCOPE_HOST=file\nURL=${SCOPE_HOST}/${SCOPE_ONLY_OS}/${SCOPE_NOWHERE}\n"
+
+	m, err := Parse(strings.NewReader(src), defaultParseOptions)
+	r.NoError(err)
+	r.Equal("file/os/", m["URL"])
+
+	m, err = Parse(strings.NewReader(src), ParseOptions{Expand: true, TrimValues: true, ExpandScope: ProcessOnly})
+	r.NoError(err)
+	r.Equal("process/os/", m["URL"])
+
+	m, err = Parse(strings.NewReader(src), ParseOptions{Expand: true, TrimValues: true, ExpandScope: FileOnly})
+	r.NoError(err)
+	r.Equal("file//", m["URL"])
+}
+
+func TestParseSeparator(t *testing.T) {
+	r := require.New(t)
+	src := "TIME:12:30\nURL=http://x:80\nMIXED:a=b\n"
+	m, err := Parse(strings.NewReader(src), ParseOptions{Expand: true, TrimValues: true, Separator: SeparatorAuto})
+	r.NoError(err)
+	r.Equal(map[string]string{"TIME": "12:30", "URL": "http://x:80", "MIXED": "a=b"}, m)
+
+	m, err = Parse(strings.NewReader("TIME=12:30\n"), ParseOptions{Expand: true, TrimValues: true, Separator: SeparatorEquals})
+	r.NoError(err)
+	r.Equal("12:30", m["TIME"])
+	_, err = Parse(strings.NewReader("TIME:12:30\n"), ParseOptions{Expand: true, TrimValues: true, Separator: SeparatorEquals})
+	r.ErrorContains(err, "unexpected separator")
+
+	m, err = Parse(strings.NewReader("TIME: 12:30\n"), ParseOptions{Expand: true, TrimValues: true, Separator: SeparatorColon})
+	r.NoError(err)
+	r.Equal("12:30", m["TIME"])
+	_, err = Parse(strings.NewReader("URL=http://x\n"), ParseOptions{Expand: true, TrimValues: true, Separator: SeparatorColon})
+	r.ErrorContains(err, "unexpected separator")
+}
+
+func TestParseLine(t *testing.T) {
+	r := require.New(t)
+	t.Setenv("PARSELINE_HOME", "/home/app")
+	tests := []struct {
+		line, key, value string
+	}{
+		{`FOO=bar`, "FOO", "bar"},
+		{`  export FOO = "a \"quoted\" value"  # comment`, "FOO", `a "quoted" value`},
+		{`TIME: 12:30`, "TIME", "12:30"},
+		{`SINGLE='$PARSELINE_HOME'`, "SINGLE", "$PARSELINE_HOME"},
+		{`EXPANDED=${PARSELINE_HOME}/bin`, "EXPANDED", "/home/app/bin"},
+		{"CRLF=value\r\n", "CRLF", "value"},
+		{`EMPTY=`, "EMPTY", ""},
+	}
+	for _, tt := range tests {
+		key, value, ok, err := ParseLine(tt.line)
+		r.NoError(err, tt.line)
+		r.True(ok, tt.line)
+		r.Equal(tt.key, key, tt.line)
+		r.Equal(tt.value, value, tt.line)
+	}
+
+	for _, line := range []string{"", "   ", "# just a comment"} {
+		_, _, ok, err := ParseLine(line)
+		r.NoError(err, line)
+		r.False(ok, line)
+	}
+
+	for _, line := range []string{"JUST_A_WORD", `OPEN="unterminated`, "BAD KEY$=x", "A=1\nB=2"} {
+		_, _, ok, err := ParseLine(line)
+		r.Error(err, line)
+		r.False(ok, line)
+	}
+}
+
+func TestParseLineEndings(t *testing.T) {
+	r := require.New(t)
+	want := map[string]string{
+		"PLAIN":  "value",
+		"QUOTED": "quoted value",
+		"MULTI":  "line1\nline2",
+		"LAST":   "end",
+	}
+	lf := "# comment\nPLAIN=value\nQUOTED=\"quoted value\" # note\nMULTI=\"line1\nline2\"\nLAST=end\n"
+	for name, src := range map[string]string{
+		"LF":   lf,
+		"CRLF": strings.ReplaceAll(lf, "\n", "\r\n"),
+		"CR":   strings.ReplaceAll(lf, "\n", "\r"),
+	} {
+		m, err := Parse(strings.NewReader(src), defaultParseOptions)
+		r.NoError(err, name)
+		r.Equal(want, m, name)
+
+		filename := filepath.Join(t.TempDir(), name+".env")
+		r.NoError(os.WriteFile(filename, []byte(src), 0o644))
+		m, err = readFile(filename)
+		r.NoError(err, name)
+		r.Equal(want, m, name)
+	}
+
+	_, err := Parse(strings.NewReader("A=1\r\nB C\r\n"), ParseOptions{Expand: true, TrimValues: true, ErrorOnBareLine: true})
+	r.ErrorContains(err, "line 2:")
+}
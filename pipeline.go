@@ -0,0 +1,38 @@
+package goenv
+
+import "fmt"
+
+// Pipeline is a chain of functions that values are passed through
+// before they are returned, for example to lowercase, URL-decode or
+// decrypt them. The zero value is an empty pipeline that returns values
+// unchanged.
+type Pipeline struct {
+	stages []func(string) (string, error)
+}
+
+// Add appends fn to the chain and returns p, so calls can be chained.
+func (p *Pipeline) Add(fn func(string) (string, error)) *Pipeline {
+	p.stages = append(p.stages, fn)
+	return p
+}
+
+// Get reads key like the package-level Get and passes the value through
+// every stage in the order they were added. The default value is
+// returned as is, without running the stages, when the key is not set.
+// A failing stage aborts the chain with an error naming the stage index
+// and its input.
+func (p *Pipeline) Get(key, defaultValue string) (string, error) {
+	v, ok := lookupEnv(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	v = TrimFunc(v)
+	for i, fn := range p.stages {
+		out, err := fn(v)
+		if err != nil {
+			return defaultValue, fmt.Errorf("%s: stage %d on %q: %w", key, i, v, err)
+		}
+		v = out
+	}
+	return v, nil
+}
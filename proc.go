@@ -0,0 +1,14 @@
+package goenv
+
+import "errors"
+
+// ErrNotSupported is returned by functions that are not available on
+// the current platform.
+var ErrNotSupported = errors.New("not supported on this platform")
+
+// FromProcess returns the environment of the process with the given
+// pid, as it was when the process started. It reads /proc/<pid>/environ
+// and is only supported on Linux; elsewhere it returns ErrNotSupported.
+func FromProcess(pid int) (map[string]string, error) {
+	return fromProcess(pid)
+}
@@ -0,0 +1,24 @@
+package goenv
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func fromProcess(pid int) (map[string]string, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/environ")
+	if err != nil {
+		return nil, err
+	}
+	envMap := map[string]string{}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+		key, value, _ := strings.Cut(string(entry), "=")
+		envMap[key] = value
+	}
+	return envMap, nil
+}
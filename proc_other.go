@@ -0,0 +1,7 @@
+//go:build !linux
+
+package goenv
+
+func fromProcess(pid int) (map[string]string, error) {
+	return nil, ErrNotSupported
+}
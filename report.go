@@ -0,0 +1,54 @@
+package goenv
+
+// Report summarizes what a load did.
+type Report struct {
+	// FilesLoaded counts the files that were read and applied.
+	FilesLoaded int
+	// KeysSet counts keys that were not set before loading.
+	KeysSet int
+	// KeysSkipped counts keys left untouched because they were already
+	// set or were excluded by the allowed or forbidden key lists.
+	KeysSkipped int
+	// KeysOverridden counts keys whose existing value was replaced.
+	KeysOverridden int
+	// Files breaks the counts down per file, in load order.
+	Files []FileReport
+}
+
+// FileReport holds the counts of a Report for a single file.
+type FileReport struct {
+	Filename       string
+	KeysSet        int
+	KeysSkipped    int
+	KeysOverridden int
+}
+
+// count records a key that was written, and whether it replaced an
+// existing value.
+func (r *FileReport) count(existed bool) {
+	if existed {
+		r.KeysOverridden++
+	} else {
+		r.KeysSet++
+	}
+}
+
+// LoadReport is like Load but also reports how many files and keys were
+// loaded, skipped and overridden, so deployment tooling can log a
+// summary. On error the report covers the files loaded before the
+// failing one.
+func LoadReport(filenames ...string) (Report, error) {
+	var report Report
+	for _, filename := range filenamesOrDefault(filenames) {
+		file, err := loadFile(filename, LoadOptions{})
+		if err != nil {
+			return report, err
+		}
+		report.FilesLoaded++
+		report.KeysSet += file.KeysSet
+		report.KeysSkipped += file.KeysSkipped
+		report.KeysOverridden += file.KeysOverridden
+		report.Files = append(report.Files, file)
+	}
+	return report, nil
+}
@@ -0,0 +1,105 @@
+package goenv
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Require returns an error listing every key that is not set.
+func Require(keys ...string) error {
+	var missing []string
+	for _, key := range keys {
+		if !IsSet(key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// RequireInteractive is like Require, but when stdin is a terminal it
+// prompts for every missing key and sets the entered value. Input is
+// not echoed for keys that look secret: keys registered with
+// MarkSensitive or containing PASSWORD, SECRET, TOKEN or KEY. When
+// stdin is not a terminal the error from Require is returned.
+func RequireInteractive(keys ...string) error {
+	err := Require(keys...)
+	if err == nil {
+		return nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return err
+	}
+
+	for _, key := range keys {
+		if IsSet(key) {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: ", key)
+
+		var value string
+		if looksSecret(key) {
+			b, err := term.ReadPassword(fd)
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		} else {
+			line, err := readLine(os.Stdin)
+			if err != nil {
+				return err
+			}
+			value = line
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return Require(keys...)
+}
+
+// readLine reads a line from r without the line ending. It reads one
+// byte at a time so nothing after the line is consumed, leaving the
+// rest of the input for term.ReadPassword.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+func looksSecret(key string) bool {
+	if IsSensitive(key) {
+		return true
+	}
+	upper := strings.ToUpper(key)
+	for _, marker := range []string{"PASSWORD", "SECRET", "TOKEN", "KEY"} {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package goenv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as described by https://semver.org.
+type Version struct {
+	Major, Minor, Patch uint64
+	Prerelease          string
+	Build               string
+}
+
+// String returns the version in MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] form.
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Semver returns the semantic version represented by the string. A
+// leading "v" is accepted. When the key is not set defaultValue is
+// parsed and returned instead.
+func Semver(key string, defaultValue string) (*Version, error) {
+	v := Get(key, "")
+	if v == "" {
+		return parseVersion(defaultValue)
+	}
+	version, err := parseVersion(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return version, nil
+}
+
+func parseVersion(s string) (*Version, error) {
+	rest := strings.TrimPrefix(s, "v")
+	var version Version
+
+	rest, build, hasBuild := strings.Cut(rest, "+")
+	if hasBuild {
+		if !validIdentifiers(build, false) {
+			return nil, fmt.Errorf("invalid semantic version %q: bad build metadata", s)
+		}
+		version.Build = build
+	}
+	rest, pre, hasPre := strings.Cut(rest, "-")
+	if hasPre {
+		if !validIdentifiers(pre, true) {
+			return nil, fmt.Errorf("invalid semantic version %q: bad pre-release", s)
+		}
+		version.Prerelease = pre
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid semantic version %q: expected MAJOR.MINOR.PATCH", s)
+	}
+	for i, dst := range []*uint64{&version.Major, &version.Minor, &version.Patch} {
+		if !isNumericIdentifier(parts[i]) {
+			return nil, fmt.Errorf("invalid semantic version %q: bad number %q", s, parts[i])
+		}
+		n, err := strconv.ParseUint(parts[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version %q: %w", s, err)
+		}
+		*dst = n
+	}
+	return &version, nil
+}
+
+// validIdentifiers reports whether s is a dot separated list of
+// [0-9A-Za-z-] identifiers. For pre-release versions numeric
+// identifiers must not have leading zeros.
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, c := range id {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if prerelease && numeric && !isNumericIdentifier(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumericIdentifier reports whether s is a number without leading zeros.
+func isNumericIdentifier(s string) bool {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
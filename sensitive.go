@@ -0,0 +1,39 @@
+package goenv
+
+import "sync"
+
+// maskedValue replaces the value of sensitive keys in output.
+const maskedValue = "****"
+
+var (
+	sensitiveMu   sync.RWMutex
+	sensitiveKeys = map[string]bool{}
+)
+
+// MarkSensitive registers keys whose values must never be printed.
+// Functions that output the environment, such as PrintEnv, replace
+// their values with a mask.
+func MarkSensitive(keys ...string) {
+	sensitiveMu.Lock()
+	for _, key := range keys {
+		sensitiveKeys[key] = true
+	}
+	sensitiveMu.Unlock()
+}
+
+// UnmarkSensitive removes keys registered with MarkSensitive, so their
+// values are printed again.
+func UnmarkSensitive(keys ...string) {
+	sensitiveMu.Lock()
+	for _, key := range keys {
+		delete(sensitiveKeys, key)
+	}
+	sensitiveMu.Unlock()
+}
+
+// IsSensitive reports whether key was registered with MarkSensitive.
+func IsSensitive(key string) bool {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	return sensitiveKeys[key]
+}
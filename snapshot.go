@@ -0,0 +1,88 @@
+package goenv
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Snapshot returns a copy of the current environment for Restore.
+func Snapshot() map[string]string {
+	return EnvMap()
+}
+
+// Restore resets the environment to snap: variables not in snap are
+// unset and the others are set to their recorded values. All variables
+// are attempted; the first error encountered is returned.
+func Restore(snap map[string]string) error {
+	var firstErr error
+	for key := range EnvMap() {
+		if _, ok := snap[key]; !ok {
+			if err := os.Unsetenv(key); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for key, value := range snap {
+		if v, ok := os.LookupEnv(key); ok && v == value {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WithTestEnv loads filename, runs fn and then restores the environment
+// to what it was before. A load error fails the test through t.Fatal.
+func WithTestEnv(t testing.TB, filename string, fn func()) {
+	t.Helper()
+	snap := Snapshot()
+	defer func() {
+		if err := Restore(snap); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	fn()
+}
+
+// MarshalDelta is like Marshal but only outputs the variables that
+// were added or changed since snap was taken, with every value quoted
+// and untrimmed so it reads back exactly as it is in the environment.
+// Variables that were removed are listed after them as
+// "# removed: KEY" comments, so the output is still a valid dotenv
+// file.
+func MarshalDelta(snap map[string]string) (string, error) {
+	changed, removed := diffEnv(snap, EnvMap())
+	lines := make([]string, 0, len(removed)+1)
+	if len(changed) > 0 {
+		lines = append(lines, marshalMapFormat(changed, quoteValue))
+	}
+	for _, k := range removed {
+		lines = append(lines, "# removed: "+k)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// diffEnv returns the variables of cur that are new or differ from old,
+// and the sorted keys of old missing from cur.
+func diffEnv(old, cur map[string]string) (changed map[string]string, removed []string) {
+	changed = map[string]string{}
+	for k, v := range cur {
+		if ov, ok := old[k]; !ok || ov != v {
+			changed[k] = v
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
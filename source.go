@@ -0,0 +1,58 @@
+package goenv
+
+import "sync"
+
+var (
+	sourcesMu sync.RWMutex
+	sources   map[string]loadedValue
+)
+
+type loadedValue struct {
+	value    string
+	filename string
+}
+
+// TrackSources turns recording of where loaded values came from on or
+// off. While enabled, every value set by Load, Overload and friends is
+// recorded together with the file it was read from so GetWithSource can
+// report it. Disabling tracking discards everything recorded so far.
+func TrackSources(enabled bool) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if enabled {
+		if sources == nil {
+			sources = map[string]loadedValue{}
+		}
+		return
+	}
+	sources = nil
+}
+
+// GetWithSource returns the value of key together with where it came
+// from: the name of the file it was loaded from, or "os" when it was
+// already in the process environment or was changed after loading.
+// found is false, and source empty, when the key is not set.
+func GetWithSource(key string) (value, source string, found bool) {
+	value, found = lookupEnv(key)
+	if !found {
+		return "", "", false
+	}
+
+	sourcesMu.RLock()
+	loaded, ok := sources[lookupKey(key)]
+	sourcesMu.RUnlock()
+	if ok && loaded.value == value {
+		return TrimFunc(value), loaded.filename, true
+	}
+	return TrimFunc(value), "os", true
+}
+
+// recordSource remembers that key was set to value from filename
+// when source tracking is enabled.
+func recordSource(key, value, filename string) {
+	sourcesMu.Lock()
+	if sources != nil {
+		sources[key] = loadedValue{value: value, filename: filename}
+	}
+	sourcesMu.Unlock()
+}
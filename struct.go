@@ -0,0 +1,178 @@
+package goenv
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValidatorFunc checks the value of a variable.
+type ValidatorFunc func(value string) error
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string][]ValidatorFunc{}
+)
+
+// RegisterValidator registers fn to be run by ValidateStruct
+// against the value of key.
+func RegisterValidator(key string, fn ValidatorFunc) {
+	validatorsMu.Lock()
+	validators[key] = append(validators[key], fn)
+	validatorsMu.Unlock()
+}
+
+// ValidateStruct checks the environment against the fields of the
+// struct v points to. Fields are mapped to keys with an `env:"KEY"`
+// tag; nested structs are walked and fields tagged `env:"-"` or
+// without a tag are skipped. Every key must be set, unless its tag
+// carries the optional flag as in `env:"KEY,optional"`, and every set
+// value must pass the validators registered for its key. All
+// violations are returned together.
+func ValidateStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("ValidateStruct: expected a struct, got %T", v)
+	}
+
+	var errs []error
+	walkEnvFields(rv, func(key string, optional bool, _ reflect.Value) {
+		value := Get(key, "")
+		if value == "" {
+			if !optional {
+				errs = append(errs, fmt.Errorf("%s: required but not set", key))
+			}
+			return
+		}
+		validatorsMu.RLock()
+		fns := validators[key]
+		validatorsMu.RUnlock()
+		for _, fn := range fns {
+			if err := fn(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// walkEnvFields calls fn for every env tagged field of v, descending
+// into nested structs. Unexported fields are skipped, except embedded
+// structs whose exported fields are promoted.
+func walkEnvFields(v reflect.Value, fn func(key string, optional bool, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("env")
+		if !ok && field.Type.Kind() == reflect.Struct && (field.IsExported() || field.Anonymous) {
+			walkEnvFields(v.Field(i), fn)
+			continue
+		}
+		if !ok || tag == "-" || !field.IsExported() {
+			continue
+		}
+		key, flags, _ := strings.Cut(tag, ",")
+		fn(key, flags == "optional", v.Field(i))
+	}
+}
+
+// UnmarshalWithDefaults populates the env tagged fields of the struct
+// v points to, using the tags described for ValidateStruct. Values come
+// from the given files, later files overriding earlier ones, overlaid
+// with the process environment; the files are read without changing
+// the environment. Supported field types are strings, booleans,
+// integers, floats, time.Duration and comma separated []string. Every
+// missing required key and unparsable value is reported.
+func UnmarshalWithDefaults(v any, filenames ...string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("UnmarshalWithDefaults: expected a pointer to a struct, got %T", v)
+	}
+	defaults, err := Resolve(nil, filenames...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	walkEnvFields(rv.Elem(), func(key string, optional bool, field reflect.Value) {
+		value, ok := lookupEnv(key)
+		if !ok {
+			value = defaults[key]
+		}
+		value = TrimFunc(value)
+		if value == "" {
+			if !optional {
+				errs = append(errs, fmt.Errorf("%s: required but not set", key))
+			}
+			return
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses value into field according to its type.
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		parts := strings.Split(value, ",")
+		elems := reflect.MakeSlice(field.Type(), 0, len(parts))
+		for _, part := range parts {
+			if part = fastTrim(part); part != "" {
+				elems = reflect.Append(elems, reflect.ValueOf(part).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(elems)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
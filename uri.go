@@ -0,0 +1,88 @@
+package goenv
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// URIScheme returns the scheme of the URL held by key, such as
+// "postgres". The default value is returned when the key is not set,
+// is not a valid URL or has no scheme.
+func URIScheme(key, defaultValue string) string {
+	u := lookupURL(key)
+	if u == nil || u.Scheme == "" {
+		return defaultValue
+	}
+	return u.Scheme
+}
+
+// URIHost returns the host name of the URL held by key, without the
+// port. The default value is returned when the key is not set, is not
+// a valid URL or has no host.
+func URIHost(key, defaultValue string) string {
+	u := lookupURL(key)
+	if u == nil || u.Hostname() == "" {
+		return defaultValue
+	}
+	return u.Hostname()
+}
+
+// URIPort returns the port of the URL held by key. The default value
+// is returned when the key is not set or the URL has no port. An
+// invalid URL results in an error, which leaves out the URL itself
+// since it may hold a password.
+func URIPort(key string, defaultValue int) (int, error) {
+	v := Get(key, "")
+	if v == "" {
+		return defaultValue, nil
+	}
+	u, err := parseSecretURL(v)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	if u.Port() == "" {
+		return defaultValue, nil
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return port, nil
+}
+
+// URIPath returns the path of the URL held by key. The default value
+// is returned when the key is not set, is not a valid URL or has an
+// empty path.
+func URIPath(key, defaultValue string) string {
+	u := lookupURL(key)
+	if u == nil || u.Path == "" {
+		return defaultValue
+	}
+	return u.Path
+}
+
+// URIQuery returns the query parameters of the URL held by key. The
+// default value is returned when the key is not set, is not a valid
+// URL or has no query.
+func URIQuery(key string, defaultValue url.Values) url.Values {
+	u := lookupURL(key)
+	if u == nil || u.RawQuery == "" {
+		return defaultValue
+	}
+	return u.Query()
+}
+
+// lookupURL parses the value of key as a URL. It returns nil when the
+// key is not set or the value cannot be parsed.
+func lookupURL(key string) *url.URL {
+	v := Get(key, "")
+	if v == "" {
+		return nil
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil
+	}
+	return u
+}
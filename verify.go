@@ -0,0 +1,43 @@
+package goenv
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ErrHashMismatch is returned by GetVerified when a value does not
+// match its expected hash.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// GetVerified returns the value of key after checking its integrity:
+// the value is hashed with algorithm, "sha256" or "sha512", and
+// compared in constant time to expected, the hex encoded hash of the
+// expected value. An unset key is an error, as is any mismatch.
+func GetVerified(key, expected, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("%s: unsupported hash algorithm %q", key, algorithm)
+	}
+	v, ok := lookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("%s: not set", key)
+	}
+	v = TrimFunc(v)
+	h.Write([]byte(v))
+	sum := hex.EncodeToString(h.Sum(nil))
+	if subtle.ConstantTimeCompare([]byte(sum), []byte(strings.ToLower(expected))) != 1 {
+		return "", fmt.Errorf("%s: %w", key, ErrHashMismatch)
+	}
+	return v, nil
+}
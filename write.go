@@ -0,0 +1,182 @@
+package goenv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AppendKey adds a KEY="value" line to the dotenv file filename,
+// creating the file if it does not exist. The value is quoted and
+// escaped the same way Marshal does, and key must be a valid variable
+// name, so neither can add extra lines to the file. If the file
+// already defines key, ErrAlreadySet is returned, unless replace is
+// passed as true, in which case the existing definition is updated in
+// place, keeping its inline comment.
+func AppendKey(filename, key, value string, replace ...bool) error {
+	if !isKeyName(key) {
+		return fmt.Errorf("invalid key name %q", key)
+	}
+	line := fmt.Sprintf(`%s="%s"`, key, doubleQuoteEscape(value))
+
+	src, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	start, end, found, err := findStatement(src, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if found {
+		if !(len(replace) > 0 && replace[0]) {
+			return fmt.Errorf("%s: %w", key, ErrAlreadySet)
+		}
+		var buf bytes.Buffer
+		buf.Write(src[:start])
+		buf.WriteString(line)
+		buf.Write(inlineComment(src[start:end]))
+		buf.Write(src[end:])
+		return writeFileAtomic(filename, buf.Bytes())
+	}
+
+	return appendLines(filename, src, line)
+}
+
+// isKeyName reports whether key matches the key names accepted by the
+// parser: [A-Za-z0-9_.]+.
+func isKeyName(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsNumber(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineComment returns the trailing comment, with the whitespace
+// before it, of a statement with an unquoted value. Quoted statements
+// found by findStatement end at the closing quote, so their comment is
+// never part of stmt.
+func inlineComment(stmt []byte) []byte {
+	sep := bytes.IndexAny(stmt, "=:")
+	if sep == -1 {
+		return nil
+	}
+	value := stmt[sep+1:]
+	if _, quoted := hasQuotePrefix(bytes.TrimLeftFunc(value, isSpace)); quoted {
+		return nil
+	}
+	for i := 1; i < len(value); i++ {
+		if value[i] == charComment && isSpace(rune(value[i-1])) {
+			j := i
+			for j > 0 && isSpace(rune(value[j-1])) {
+				j--
+			}
+			return value[j:]
+		}
+	}
+	return nil
+}
+
+// EnsureFile adds every key of defaults that the dotenv file filename
+// does not define yet, creating the file if needed. Existing content,
+// including values, comments and order, is kept as is; missing keys
+// are appended in sorted order, formatted like AppendKey.
+func EnsureFile(filename string, defaults map[string]string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	existing := map[string]string{}
+	if err := parseBytes(src, existing, defaultParseOptions); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	var missing []string
+	for key := range defaults {
+		if _, ok := existing[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+
+	lines := make([]string, len(missing))
+	for i, key := range missing {
+		lines[i] = fmt.Sprintf(`%s="%s"`, key, doubleQuoteEscape(defaults[key]))
+	}
+	return appendLines(filename, src, lines...)
+}
+
+// appendLines appends lines to filename, whose current content is src,
+// making sure they start on a new line.
+func appendLines(filename string, src []byte, lines ...string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	out := strings.Join(lines, "\n") + "\n"
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		out = "\n" + out
+	}
+	if _, err = f.WriteString(out); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// MarshalToFile writes envMap to filename as KEY="VALUE" lines sorted
+// by key, with every value quoted so it reads back exactly as written,
+// replacing the file atomically: the content goes to a temporary file
+// in the same directory that is then renamed over filename, so a crash
+// leaves either the old or the new file, never a partial one. A new
+// file is created with mode 0600; an existing file keeps its mode.
+func MarshalToFile(filename string, envMap map[string]string) error {
+	return writeFileAtomic(filename, []byte(marshalMapFormat(envMap, quoteValue)+"\n"))
+}
+
+// writeFileAtomic replaces filename with data using a temporary file
+// and a rename.
+func writeFileAtomic(filename string, data []byte) (err error) {
+	mode := fs.FileMode(0o600)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
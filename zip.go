@@ -0,0 +1,52 @@
+package goenv
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// LoadZip loads the entries named envFilenames (".env" by default)
+// from the zip archive at zipPath, in order, without extracting it.
+// Like Load, variables that are already set are left untouched.
+func LoadZip(zipPath string, envFilenames ...string) error {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, name := range filenamesOrDefault(envFilenames) {
+		envMap, err := readZipEntry(&archive.Reader, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", zipPath, err)
+		}
+		applyEnvMap(envMap, zipPath+":"+name, LoadOptions{})
+	}
+	return nil
+}
+
+func readZipEntry(archive *zip.Reader, name string) (map[string]string, error) {
+	for _, f := range archive.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, rc); err != nil {
+			return nil, err
+		}
+		envMap := map[string]string{}
+		if err := parseBytes(buf.Bytes(), envMap, defaultParseOptions); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return envMap, nil
+	}
+	return nil, fmt.Errorf("%s: no such entry", name)
+}